@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/imarsman/mgun/internal/lib"
+)
+
+// notifyInterim print an interim report of a run on every SIGUSR1
+func notifyInterim(run *lib.Run) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			run.ReportInterim()
+		}
+	}()
+}
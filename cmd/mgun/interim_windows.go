@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "github.com/imarsman/mgun/internal/lib"
+
+// notifyInterim do nothing, Windows having no SIGUSR1
+func notifyInterim(run *lib.Run) {}
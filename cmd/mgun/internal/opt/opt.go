@@ -1,6 +0,0 @@
-package opt
-
-var (
-	// Output whether to write to output or not
-	Output string
-)
@@ -1,16 +1,17 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
-	"github.com/imarsman/mgun/cmd/mgun/internal/lib"
-	"github.com/imarsman/mgun/cmd/mgun/internal/opt"
-	yaml "gopkg.in/yaml.v2"
+	"github.com/imarsman/mgun/internal/lib"
 )
 
 // Embed example config file plus build info in buiild for use in help output
@@ -29,20 +30,100 @@ func printHelp() {
 	fmt.Println(readme)
 }
 
+// serve run the mock server, with its own flags
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	var file string
+	flags.StringVar(&file, "f", "", "path to a routes yaml file, the demo routes otherwise - optional")
+
+	var addr string
+	flags.StringVar(&addr, "addr", "", fmt.Sprintf("address to listen on, %s by default - optional", lib.SERVE_ADDRESS))
+	flags.Parse(args)
+
+	server, err := lib.NewServer(file)
+	if err == nil {
+		if addr != "" {
+			server.Listen = addr
+		}
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// interruptible get a context that is cancelled on the first Ctrl-C or
+// SIGTERM, so that the run stops and reports what it measured. A second one
+// quits right away.
+func interruptible() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Printf("\nInterrupted, waiting up to %v for requests in flight. Interrupt again to quit.\n", lib.STOP_GRACE)
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+	return ctx
+}
+
 func main() {
+	// serve runs the mock server rather than an attack
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+
 	var output string
 	flag.StringVar(&output, "o", "", "output file name - optional")
 
 	var file string
 	flag.StringVar(&file, "f", "", "path to configuration yaml file - required")
 
+	var env string
+	flag.StringVar(&env, "env", "", "name of an environment from the configuration to apply - optional")
+
+	var statsInterval time.Duration
+	flag.DurationVar(&statsInterval, "stats", 0, "print a line of statistics at this interval instead of a progress bar - optional")
+
+	var metricsAddress string
+	flag.StringVar(&metricsAddress, "metrics-addr", "", "address such as :9102 to serve Prometheus metrics at /metrics during the run - optional")
+
+	var metricsLinger time.Duration
+	flag.DurationVar(&metricsLinger, "metrics-linger", 0, "how long metrics are still served after the run, for a last scrape - optional")
+
+	var dashboard bool
+	flag.BoolVar(&dashboard, "dashboard", false, "show a live dashboard, or a line of statistics every second without a terminal - optional")
+
 	var help bool
 	flag.BoolVar(&help, "h", false, "print usage")
 
 	var sample bool
 	flag.BoolVar(&sample, "s", false, "print sample")
 
-	flag.Parse()
+	// Capacity search, instead of a run at the configured rate
+	var findCapacity bool
+	flag.BoolVar(&findCapacity, "find-capacity", false, "search for the highest rate that meets the SLOs - optional")
+
+	capacity := new(lib.Capacity)
+	flag.IntVar(&capacity.Start, "capacity-start", 10, "first rate per second of a capacity search")
+	flag.IntVar(&capacity.Max, "capacity-max", 10000, "highest rate per second of a capacity search")
+	flag.IntVar(&capacity.Step, "capacity-step", 0, "rate added at every step, or 0 to double it and then search in halves")
+	flag.IntVar(&capacity.Precision, "capacity-precision", 0, "how close the search in halves gets, or 0 for 5% of the rate")
+	flag.DurationVar(&capacity.Duration, "capacity-duration", 30*time.Second, "steady window of a step")
+	flag.DurationVar(&capacity.Warmup, "capacity-warmup", 5*time.Second, "time left out at the start of a step")
+	flag.DurationVar(&capacity.P95, "slo-p95", 500*time.Millisecond, "highest 95th percentile response time of a passing step")
+	flag.Float64Var(&capacity.ErrorRate, "slo-error-rate", 1, "highest percentage of failed requests of a passing step")
+
+	// run is the default command, so it can be left out
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
 	// A simple function to print the build information
 	var buildinfo = func() {
@@ -55,7 +136,8 @@ func main() {
 
 	// A simple function to print command option information
 	var usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s [run]:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  or %s serve [-f routes.yaml] [-addr host:port] to run a mock server\n", os.Args[0])
 
 		flag.PrintDefaults()
 	}
@@ -88,52 +170,41 @@ func main() {
 		os.Exit(1)
 	}
 
-	// If output was specified by -o parameter set the opt package Output value
-	if output != "" {
-		lib.SetOutput(output)
-		opt.Output = output
-	}
-
-	bytes, err := ioutil.ReadFile(file)
+	// Compose the configuration with the files it extends and the environment
+	bytes, err := lib.LoadConfig(file, env)
 	if err == nil {
-
-		attack := lib.GetAttack()
-		target := lib.NewTarget()
-		callCollection := lib.GetCallCollection()
-		reporter := lib.GetReporter()
-		// Try to read in settings for the overall test to be run
-		err := yaml.Unmarshal(bytes, attack)
+		// Read in the settings for the overall test, the target, reporting,
+		// headers, params, and requests. Relative paths in the configuration
+		// are resolved against its directory.
+		var run *lib.Run
+		run, err = lib.NewRun(bytes, file)
 		if err == nil {
-			err = yaml.Unmarshal(bytes, target)
-			if err == nil {
-				// Try to read in settings for reporting
-				err = yaml.Unmarshal(bytes, reporter)
-				if err == nil {
-					// If nothing was specified in command line output parameter
-					// try for a value from config.
-					if opt.Output == "" {
-						opt.Output = reporter.Output
-					}
-					// Try to read in settings for headers, params, and requests
-					err = yaml.Unmarshal(bytes, callCollection)
-					if err == nil {
-						attack.SetTarget(target)
-						attack.SetGun(callCollection)
-						attack.Prepare()
-						attack.Start()
-					} else {
-						fmt.Println(err)
-					}
-				} else {
-					fmt.Println(err)
-				}
+			// The output file given on the command line wins over the one of
+			// the configuration
+			if output != "" {
+				run.SetOutput(output)
+			}
+			if statsInterval > 0 {
+				run.SetStatsInterval(statsInterval)
+			}
+			if dashboard {
+				run.SetDashboard(true)
+			}
+			if metricsAddress != "" {
+				err = run.ServeMetrics(metricsAddress, metricsLinger)
+			}
+		}
+		if err == nil {
+			notifyInterim(run)
+			ctx := interruptible()
+			if findCapacity {
+				err = run.Attack().FindCapacity(ctx, capacity)
 			} else {
-				fmt.Println(err)
+				run.Attack().Start(ctx)
 			}
-		} else {
-			fmt.Println(err)
 		}
-	} else {
+	}
+	if err != nil {
 		fmt.Println(err)
 	}
 }
@@ -0,0 +1,292 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AUTH_TYPE_NONE   = "none"
+	AUTH_TYPE_BASIC  = "basic"
+	AUTH_TYPE_BEARER = "bearer"
+	AUTH_TYPE_OAUTH2 = "oauth2"
+
+	OAUTH2_GRANT_CLIENT_CREDENTIALS = "client_credentials"
+	OAUTH2_GRANT_PASSWORD           = "password"
+	OAUTH2_GRANT_REFRESH_TOKEN      = "refresh_token"
+)
+
+// Auth authentication added to requests, given with the auth key globally or
+// for a single request. Values may use params, so with ${session.login} each
+// virtual user authenticates as its own session.
+//
+//	auth:
+//	  type: oauth2
+//	  token_url: https://auth.example.com/oauth/token
+//	  grant: client_credentials
+//	  client_id: loadtest
+//	  client_secret: secret
+//
+// OAuth2 tokens are fetched once per virtual user and refreshed shortly before
+// they expire. Token fetches are reported on their own line.
+type Auth struct {
+	kind          string
+	username      *Feature
+	password      *Feature
+	token         *Feature
+	tokenURL      *Feature
+	grant         string
+	clientID      *Feature
+	clientSecret  *Feature
+	clientAuth    string
+	scope         *Feature
+	refreshBefore time.Duration
+	cartridge     *Cartridge
+}
+
+func (a *Auth) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	var rawAuth interface{}
+	if err := unmarshal(&rawAuth); err != nil {
+		return err
+	}
+	auth, err := NewAuth(rawAuth)
+	if err != nil {
+		return err
+	}
+	*a = *auth
+	return nil
+}
+
+// NewAuth create authentication from its raw configuration value
+func NewAuth(rawAuth interface{}) (*Auth, error) {
+	auth := new(Auth)
+	if kind, ok := rawAuth.(string); ok && kind == AUTH_TYPE_NONE {
+		auth.kind = AUTH_TYPE_NONE
+		return auth, nil
+	}
+	rawMap, ok := rawAuth.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid auth %v", rawAuth)
+	}
+	value := func(key string) *Feature {
+		if rawValue, ok := rawMap[key]; ok {
+			return NewDescribedFeature(fmt.Sprintf("%v", rawValue))
+		}
+		return nil
+	}
+
+	auth.kind, _ = rawMap["type"].(string)
+	auth.username = value("username")
+	auth.password = value("password")
+	auth.token = value("token")
+	auth.tokenURL = value("token_url")
+	auth.grant, _ = rawMap["grant"].(string)
+	auth.clientID = value("client_id")
+	auth.clientSecret = value("client_secret")
+	auth.clientAuth, _ = rawMap["client_auth"].(string)
+	auth.scope = value("scope")
+	if refreshBefore, ok := rawMap["refresh_before"].(int); ok {
+		auth.refreshBefore = time.Duration(refreshBefore) * time.Second
+	} else {
+		auth.refreshBefore = 30 * time.Second
+	}
+
+	switch auth.kind {
+	case AUTH_TYPE_NONE:
+	case AUTH_TYPE_BASIC:
+		if auth.username == nil {
+			return nil, fmt.Errorf("basic auth needs a username")
+		}
+	case AUTH_TYPE_BEARER:
+		if auth.token == nil {
+			return nil, fmt.Errorf("bearer auth needs a token")
+		}
+	case AUTH_TYPE_OAUTH2:
+		if auth.tokenURL == nil {
+			return nil, fmt.Errorf("oauth2 auth needs a token_url")
+		}
+		if len(auth.grant) == 0 {
+			auth.grant = OAUTH2_GRANT_CLIENT_CREDENTIALS
+		}
+		if auth.grant != OAUTH2_GRANT_CLIENT_CREDENTIALS && auth.grant != OAUTH2_GRANT_PASSWORD {
+			return nil, fmt.Errorf("unsupported oauth2 grant %s", auth.grant)
+		}
+		if auth.grant == OAUTH2_GRANT_PASSWORD && (auth.username == nil || auth.password == nil) {
+			return nil, fmt.Errorf("oauth2 password grant needs a username and password")
+		}
+		tokenURL := fmt.Sprintf("%v", rawMap["token_url"])
+		auth.cartridge = &Cartridge{
+			path:               NewNamedDescribedFeature(POST_METHOD, tokenURL),
+			successStatusCodes: []int{200},
+		}
+		auth.cartridge.path.rawDescription = tokenURL + " (oauth2 token)"
+	default:
+		return nil, fmt.Errorf("unsupported auth type %s", auth.kind)
+	}
+	return auth, nil
+}
+
+// oauth2Token a token fetched for a virtual user
+type oauth2Token struct {
+	accessToken  string
+	refreshToken string
+	refreshAt    time.Time
+}
+
+func (t *oauth2Token) valid() bool {
+	return t.refreshAt.IsZero() || time.Now().Before(t.refreshAt)
+}
+
+// oauth2Tokens the tokens cached by a virtual user
+type oauth2Tokens struct {
+	sync.Mutex
+	byAuth map[*Auth]*oauth2Token
+}
+
+// authorize add authentication to a request just before it is sent, fetching
+// an OAuth2 token first when the cached one is missing or about to expire
+func (k *Killer) authorize(request *http.Request, auth *Auth, hits chan<- *Hit) error {
+	switch auth.kind {
+	case AUTH_TYPE_BASIC:
+		password := ""
+		if auth.password != nil {
+			password = auth.password.String(k)
+		}
+		request.SetBasicAuth(auth.username.String(k), password)
+	case AUTH_TYPE_BEARER:
+		request.Header.Set("Authorization", "Bearer "+auth.token.String(k))
+	case AUTH_TYPE_OAUTH2:
+		token, err := k.oauth2Token(auth, hits)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token.accessToken)
+	}
+	return nil
+}
+
+func (k *Killer) oauth2Token(auth *Auth, hits chan<- *Hit) (*oauth2Token, error) {
+	k.tokens.Lock()
+	defer k.tokens.Unlock()
+
+	if k.tokens.byAuth == nil {
+		k.tokens.byAuth = make(map[*Auth]*oauth2Token)
+	}
+	token, ok := k.tokens.byAuth[auth]
+	if ok && token.valid() {
+		return token, nil
+	}
+
+	if ok && len(token.refreshToken) > 0 {
+		params := url.Values{}
+		params.Set("grant_type", OAUTH2_GRANT_REFRESH_TOKEN)
+		params.Set("refresh_token", token.refreshToken)
+		refreshed, err := k.fetchOAuth2Token(auth, params, hits)
+		if err == nil {
+			if len(refreshed.refreshToken) == 0 {
+				refreshed.refreshToken = token.refreshToken
+			}
+			k.tokens.byAuth[auth] = refreshed
+			return refreshed, nil
+		}
+		// The refresh token may have expired as well, so start over
+		k.run.log("oauth2 token not refreshed, error: %v", err)
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", auth.grant)
+	if auth.grant == OAUTH2_GRANT_PASSWORD {
+		params.Set("username", auth.username.String(k))
+		params.Set("password", auth.password.String(k))
+	}
+	token, err := k.fetchOAuth2Token(auth, params, hits)
+	if err != nil {
+		delete(k.tokens.byAuth, auth)
+		return nil, err
+	}
+	k.tokens.byAuth[auth] = token
+	return token, nil
+}
+
+func (k *Killer) fetchOAuth2Token(auth *Auth, params url.Values, hits chan<- *Hit) (*oauth2Token, error) {
+	clientID, clientSecret := "", ""
+	if auth.clientID != nil {
+		clientID = auth.clientID.String(k)
+	}
+	if auth.clientSecret != nil {
+		clientSecret = auth.clientSecret.String(k)
+	}
+	if auth.scope != nil {
+		params.Set("scope", auth.scope.String(k))
+	}
+	if auth.clientAuth == "body" {
+		params.Set("client_id", clientID)
+		params.Set("client_secret", clientSecret)
+	}
+
+	request, err := http.NewRequest(POST_METHOD, auth.tokenURL.String(k), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if auth.clientAuth != "body" && len(clientID) > 0 {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	hit := new(Hit)
+	hit.shot = &Shot{cartridge: auth.cartridge, request: request, killer: k}
+	client := &http.Client{Timeout: k.getTimeout()}
+	hit.startTime = time.Now()
+	resp, err := client.Do(request.WithContext(k.requestContext()))
+	hit.endTime = time.Now()
+	hit.err = err
+	var body []byte
+	if err == nil {
+		hit.response = resp
+		body, _ = ioutil.ReadAll(resp.Body)
+		hit.bodySize = int64(len(body))
+		resp.Body.Close()
+	}
+	if hits != nil {
+		hits <- hit
+	}
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token not received, error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth2 token not received, status: %d", resp.StatusCode)
+	}
+
+	var tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("invalid oauth2 token response: %v", err)
+	}
+	if len(tokenResponse.AccessToken) == 0 {
+		return nil, fmt.Errorf("oauth2 token response has no access_token")
+	}
+	token := &oauth2Token{
+		accessToken:  tokenResponse.AccessToken,
+		refreshToken: tokenResponse.RefreshToken,
+	}
+	if tokenResponse.ExpiresIn > 0 {
+		// Refresh early, but never later than half way through a short lifetime
+		lifetime := time.Duration(tokenResponse.ExpiresIn) * time.Second
+		refreshBefore := auth.refreshBefore
+		if refreshBefore > lifetime/2 {
+			refreshBefore = lifetime / 2
+		}
+		token.refreshAt = hit.startTime.Add(lifetime - refreshBefore)
+	}
+	return token, nil
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newTestAuth(t *testing.T, config string) *Auth {
+	auth := new(Auth)
+	if err := yaml.Unmarshal([]byte(config), auth); err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestAuthBasicAndBearer(t *testing.T) {
+	killer := new(Killer)
+
+	request := httptest.NewRequest(GET_METHOD, "/", nil)
+	auth := newTestAuth(t, "{type: basic, username: user, password: pass}")
+	if err := killer.authorize(request, auth, nil); err != nil {
+		t.Fatal(err)
+	}
+	if username, password, ok := request.BasicAuth(); !ok || username != "user" || password != "pass" {
+		t.Errorf("got basic auth %s:%s", username, password)
+	}
+
+	request = httptest.NewRequest(GET_METHOD, "/", nil)
+	auth = newTestAuth(t, "{type: bearer, token: abc}")
+	if err := killer.authorize(request, auth, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := request.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("got authorization %s", got)
+	}
+}
+
+func TestAuthOAuth2CachesAndRefreshes(t *testing.T) {
+	var fetches, refreshes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "loadtest" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Form.Get("grant_type") {
+		case OAUTH2_GRANT_CLIENT_CREDENTIALS:
+			atomic.AddInt32(&fetches, 1)
+		case OAUTH2_GRANT_REFRESH_TOKEN:
+			atomic.AddInt32(&refreshes, 1)
+		}
+		count := atomic.LoadInt32(&fetches) + atomic.LoadInt32(&refreshes)
+		fmt.Fprintf(w, `{"access_token":"token-%d","refresh_token":"refresh","expires_in":3600}`, count)
+	}))
+	defer server.Close()
+
+	auth := newTestAuth(t, fmt.Sprintf(
+		"{type: oauth2, token_url: %s, client_id: loadtest, client_secret: secret}",
+		server.URL,
+	))
+	killer := new(Killer)
+	hits := make(chan *Hit, 10)
+
+	for i := 0; i < 3; i++ {
+		request := httptest.NewRequest(GET_METHOD, "/", nil)
+		if err := killer.authorize(request, auth, hits); err != nil {
+			t.Fatal(err)
+		}
+		if got := request.Header.Get("Authorization"); got != "Bearer token-1" {
+			t.Errorf("got authorization %s, want the cached token", got)
+		}
+	}
+	if fetches != 1 || len(hits) != 1 {
+		t.Errorf("got %d fetches and %d hits, want 1", fetches, len(hits))
+	}
+
+	// Expire the token to force a refresh
+	killer.tokens.byAuth[auth].refreshAt = time.Now().Add(-time.Second)
+	request := httptest.NewRequest(GET_METHOD, "/", nil)
+	if err := killer.authorize(request, auth, hits); err != nil {
+		t.Fatal(err)
+	}
+	if got := request.Header.Get("Authorization"); got != "Bearer token-2" {
+		t.Errorf("got authorization %s, want a refreshed token", got)
+	}
+	if refreshes != 1 || len(hits) != 2 {
+		t.Errorf("got %d refreshes and %d hits, want 1 and 2", refreshes, len(hits))
+	}
+}
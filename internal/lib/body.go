@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// extraContentTypes content types for body file extensions that are not
+// known to the mime package on every platform
+var extraContentTypes = map[string]string{
+	".json":   "application/json",
+	".xml":    "application/xml",
+	".ndjson": "application/x-ndjson",
+	".jsonl":  "application/x-ndjson",
+	".txt":    "text/plain; charset=utf-8",
+}
+
+// bodyTemplateFuncs functions available to body templates in addition to the
+// text/template builtins
+var bodyTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Body the payload of a request, given with the body key. It can be
+//
+//	body: inline text, with ${param} substitution
+//	body: "@path/to/file.bin", sent verbatim so binary payloads work
+//	body:
+//	  file: path/to/file.json
+//	  template: true
+//
+// Inline text and files marked as templates are executed as Go text/template
+// with access to params through {{.Param "name"}} and extracted variables
+// through {{.Var "name"}}.
+type Body struct {
+	// the file the body is read from, once the configuration has been read
+	file        string
+	isTemplate  bool
+	text        *Feature
+	data        []byte
+	template    *template.Template
+	contentType string
+}
+
+// NewBody create a body from its raw configuration value
+func NewBody(rawBody interface{}) (*Body, error) {
+	body := new(Body)
+	switch rawBody.(type) {
+	case string:
+		text := rawBody.(string)
+		if strings.HasPrefix(text, "@") {
+			body.file = strings.TrimPrefix(text, "@")
+			return body, nil
+		}
+		return body, body.setText(text)
+	case map[interface{}]interface{}:
+		rawMap := rawBody.(map[interface{}]interface{})
+		if file, ok := rawMap["file"].(string); ok {
+			body.file = file
+			body.isTemplate, _ = rawMap["template"].(bool)
+			return body, nil
+		}
+		if text, ok := rawMap["text"].(string); ok {
+			return body, body.setText(text)
+		}
+		return nil, fmt.Errorf("body needs a file or text value")
+	default:
+		return body, body.setText(fmt.Sprintf("%v", rawBody))
+	}
+}
+
+func (b *Body) setText(text string) error {
+	b.contentType = "text/plain; charset=utf-8"
+	if strings.Contains(text, "{{") {
+		return b.setTemplate(text)
+	}
+	b.text = NewDescribedFeature(text)
+	return nil
+}
+
+func (b *Body) setTemplate(text string) error {
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid body template: %v", err)
+	}
+	b.template = tmpl
+	return nil
+}
+
+// prepare read the file of a body, relative to the configuration files it
+// was read from
+func (b *Body) prepare(files []string) error {
+	if len(b.file) == 0 {
+		return nil
+	}
+	return b.loadFile(resolvePath(files, b.file), b.isTemplate)
+}
+
+func (b *Body) loadFile(path string, isTemplate bool) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read body file: %v", err)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if contentType, ok := extraContentTypes[ext]; ok {
+		b.contentType = contentType
+	} else if contentType := mime.TypeByExtension(ext); len(contentType) > 0 {
+		b.contentType = contentType
+	} else {
+		b.contentType = "application/octet-stream"
+	}
+	if isTemplate {
+		return b.setTemplate(string(data))
+	}
+	b.data = data
+	return nil
+}
+
+// bytes build the payload for a killer
+func (b *Body) bytes(killer *Killer) ([]byte, error) {
+	if b.template != nil {
+		var buf bytes.Buffer
+		err := b.template.Execute(&buf, &bodyTemplateData{killer: killer})
+		return buf.Bytes(), err
+	}
+	if b.text != nil {
+		return []byte(b.text.String(killer)), nil
+	}
+	return b.data, nil
+}
+
+// bodyTemplateData the value body templates are executed against
+type bodyTemplateData struct {
+	killer *Killer
+}
+
+// Param get the value of a param, for example {{.Param "session.login"}}
+func (d *bodyTemplateData) Param(name string) string {
+	value, _ := d.killer.callCollection.findValue(d.killer, name)
+	return value
+}
+
+// Var get the value of a variable extracted from an earlier response
+func (d *bodyTemplateData) Var(name string) string {
+	value, _ := d.killer.getVar(name)
+	return value
+}
+
+// List get a variable as a list, for example {{json (.List "ids")}}
+func (d *bodyTemplateData) List(name string) []string {
+	return d.killer.getList(name)
+}
+
+// mediaType get the lower case media type of a Content-Type header value
+// without parameters such as charset
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"order.json":      `{"id": ${not.substituted}}`,
+		"order.tmpl.json": `{"user": {{json (.Param "user")}}, "order": "{{.Var "order"}}"}`,
+		"events.NDJSON":   "{\"a\":1}\n{\"a\":2}\n",
+		"page.xml":        "<page/>",
+		"blob":            "\x00\x01\xff",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collection := &CallCollection{run: &Run{reporter: new(Reporter)}, Calibers: make(CaliberMap)}
+	collection.Calibers.fill(map[interface{}]interface{}{"user": "alice"})
+	killer := &Killer{callCollection: collection}
+	killer.setVar("order", "42")
+
+	tests := []struct {
+		raw         string
+		want        string
+		contentType string
+	}{
+		{`hello ${user}`, "hello alice", "text/plain; charset=utf-8"},
+		{`{text: "{{.Param \"user\"}} ordered {{.Var \"order\"}}"}`, "alice ordered 42", "text/plain; charset=utf-8"},
+		{`"@order.json"`, files["order.json"], "application/json"},
+		{`{file: order.tmpl.json, template: true}`, `{"user": "alice", "order": "42"}`, "application/json"},
+		{`{file: order.json}`, files["order.json"], "application/json"},
+		{`"@events.NDJSON"`, files["events.NDJSON"], "application/x-ndjson"},
+		{`"@page.xml"`, files["page.xml"], "application/xml"},
+		{`"@blob"`, files["blob"], "application/octet-stream"},
+		{`42`, "42", "text/plain; charset=utf-8"},
+	}
+	for _, test := range tests {
+		var raw interface{}
+		if err := yaml.Unmarshal([]byte(test.raw), &raw); err != nil {
+			t.Fatalf("%s: %v", test.raw, err)
+		}
+		body, err := NewBody(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", test.raw, err)
+		}
+		if err := body.prepare([]string{filepath.Join(dir, "config.yaml")}); err != nil {
+			t.Fatalf("%s: %v", test.raw, err)
+		}
+		got, err := body.bytes(killer)
+		if err != nil {
+			t.Fatalf("%s: %v", test.raw, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got body %q, want %q", test.raw, got, test.want)
+		}
+		if body.contentType != test.contentType {
+			t.Errorf("%s: got content type %s, want %s", test.raw, body.contentType, test.contentType)
+		}
+	}
+
+	if _, err := NewBody(map[interface{}]interface{}{"template": true}); err == nil {
+		t.Error("expected an error for a body without a file or text")
+	}
+	body, _ := NewBody("@missing.json")
+	if err := body.prepare([]string{filepath.Join(dir, "config.yaml")}); err == nil {
+		t.Error("expected an error for a missing body file")
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	tests := map[string]string{
+		"application/json":                "application/json",
+		"application/json; charset=utf-8": "application/json",
+		"Application/JSON; Charset=UTF-8": "application/json",
+		"text/plain;charset=utf-8":        "text/plain",
+		"  TEXT/HTML ; charset=latin1":    "text/html",
+		"application/x-ndjson; charset":   "application/x-ndjson",
+		"":                                "",
+	}
+	for contentType, want := range tests {
+		if got := mediaType(contentType); got != want {
+			t.Errorf("%q: got %q, want %q", contentType, got, want)
+		}
+	}
+}
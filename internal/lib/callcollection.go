@@ -0,0 +1,796 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	arrayParamRegexp  = regexp.MustCompile(`[\w\d\-\_]\[\]+`)
+	configParamRegexp = regexp.MustCompile(`\$\{([\w\d\-\_\.]+)\}`)
+	// methodRegexp any upper case HTTP method token, including custom verbs
+	methodRegexp = regexp.MustCompile(`^[A-Z][A-Z0-9!#$%&'*+.^_|~-]*$`)
+)
+
+// CallCollection collection of parameters for a call
+type CallCollection struct {
+	run        *Run
+	Features   Features   `yaml:"headers"`
+	Calibers   CaliberMap `yaml:"params"`
+	Cartridges Cartridges `yaml:"requests"`
+	Auth       *Auth      `yaml:"auth"`
+	Signing    *Signing   `yaml:"signing"`
+	Scenarios  Scenarios  `yaml:"scenarios"`
+	// requests run once before the load, once by each virtual user before
+	// its first script and once after the load
+	Setup    Cartridges `yaml:"setup"`
+	VUSetup  Cartridges `yaml:"vu_setup"`
+	Teardown Cartridges `yaml:"teardown"`
+	// seconds an iteration of the script takes at least
+	Pacing float64 `yaml:"pacing"`
+	// how sessions slow down when the server is overloaded
+	Backoff           *Backoff `yaml:"backoff"`
+	RespectRetryAfter bool     `yaml:"respect_retry_after"`
+	// cartridges for requests made on the side, such as OAuth2 token fetches,
+	// so that they get their own line in the report
+	auxiliaryCartridges Cartridges
+}
+
+func (cc *CallCollection) prepare() error {
+	if len(cc.Scenarios) > 0 && len(cc.Cartridges) > 0 {
+		return fmt.Errorf("requests and scenarios cannot be used together, move the requests to a scenario")
+	}
+	if len(cc.Cartridges) == 0 && len(cc.Scenarios) == 0 {
+		cartridge := new(Cartridge)
+		cartridge.path = NewNamedDescribedFeature(GET_METHOD, "/")
+		cc.Cartridges = append(cc.Cartridges, cartridge)
+	}
+	cc.run.log("cartridges count - %v", len(cc.Cartridges))
+
+	if cc.Calibers == nil {
+		cc.Calibers = make(CaliberMap)
+	}
+	if cc.RespectRetryAfter && cc.Backoff == nil {
+		// Only Retry-After is honoured, up to the default max
+		cc.Backoff, _ = NewBackoff(map[interface{}]interface{}{})
+		cc.Backoff.statuses = []int{}
+	}
+	// Files are read and requests are given ids once the whole configuration
+	// has been read
+	for _, cartridges := range []Cartridges{cc.Setup, cc.VUSetup, cc.Cartridges, cc.Teardown} {
+		if err := cc.run.prepareCartridges(cartridges, cc.run.getConfigFiles()); err != nil {
+			return err
+		}
+	}
+	cc.preparePhases()
+	allCartridges := make(Cartridges, 0)
+	for _, cartridges := range []Cartridges{cc.Setup, cc.VUSetup, cc.Cartridges, cc.Teardown} {
+		cc.addIncludedCalibers(cartridges)
+		allCartridges = append(allCartridges, cartridges.toPlainSlice()...)
+	}
+
+	cc.auxiliaryCartridges = make(Cartridges, 0)
+	if cc.Auth != nil {
+		cc.addAuxiliaryCartridge(cc.Auth.cartridge)
+	}
+	for _, cartridge := range allCartridges {
+		if cartridge.auth != nil {
+			cc.addAuxiliaryCartridge(cartridge.auth.cartridge)
+		}
+	}
+
+	if len(cc.Scenarios) == 0 {
+		return nil
+	}
+	for _, scenario := range cc.getScenarios() {
+		name := scenario.name
+		if len(scenario.callCollection.Scenarios) > 0 {
+			return fmt.Errorf("scenario %s cannot have scenarios of its own", name)
+		}
+		if len(scenario.callCollection.Cartridges) == 0 {
+			return fmt.Errorf("scenario %s has no requests", name)
+		}
+		if len(scenario.callCollection.Setup) > 0 || len(scenario.callCollection.Teardown) > 0 {
+			return fmt.Errorf("scenario %s cannot have setup or teardown, they run once for the whole run", name)
+		}
+		scenario.callCollection.inherit(cc)
+		if err := scenario.callCollection.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *CallCollection) addAuxiliaryCartridge(cartridge *Cartridge) {
+	if cartridge == nil {
+		return
+	}
+	// Cartridges shared between scenarios, such as the token fetch of the top
+	// level auth, keep the id they were first given
+	if cartridge.id == 0 {
+		cartridge.id = cc.run.nextID()
+	}
+	cc.auxiliaryCartridges = append(cc.auxiliaryCartridges, cartridge)
+}
+
+// getSigning get the request signing for a cartridge, its own if it has one
+// and the global one otherwise
+func (cc *CallCollection) getSigning(cartridge *Cartridge) *Signing {
+	signing := cc.Signing
+	if cartridge.signing != nil {
+		signing = cartridge.signing
+	}
+	if signing == nil || signing.kind == SIGNING_TYPE_NONE {
+		return nil
+	}
+	return signing
+}
+
+// getReportCartridges get all cartridges that hits can be reported for
+func (cc *CallCollection) getReportCartridges() Cartridges {
+	return append(cc.Cartridges.toPlainSlice(), cc.auxiliaryCartridges...)
+}
+
+// getAuth get the authentication for a cartridge, its own if it has one and
+// the global one otherwise
+func (cc *CallCollection) getAuth(cartridge *Cartridge) *Auth {
+	auth := cc.Auth
+	if cartridge.auth != nil {
+		auth = cartridge.auth
+	}
+	if auth == nil || auth.kind == AUTH_TYPE_NONE {
+		return nil
+	}
+	return auth
+}
+
+// findCaliber check a call
+func (cc *CallCollection) findCaliber(killer *Killer, path string) *Caliber {
+	parts := strings.Split(path, ".")
+	if caliber, ok := cc.Calibers[parts[0]]; ok {
+		return cc.findInCaliber(killer, caliber, parts[1:])
+	}
+	return nil
+}
+
+// findInCaliber get a random call from the list in the configuration, drawn
+// from the killer's own source
+func (cc *CallCollection) findInCaliber(killer *Killer, caliber *Caliber, pathParts []string) *Caliber {
+	nextPathParts := cc.getNextPathParts(pathParts)
+	switch caliber.kind {
+	case CALIBER_KIND_LIST:
+		calibers := caliber.feature.description.(CaliberList)
+		randCaliber := calibers[killer.rand.Intn(len(calibers))]
+		if randCaliber.kind == CALIBER_KIND_MAP {
+			return cc.findInCaliber(killer, randCaliber, nextPathParts)
+		} else {
+			return randCaliber
+		}
+	case CALIBER_KIND_MAP:
+		caliberMap := caliber.feature.description.(CaliberMap)
+		if childCaliber, ok := caliberMap[pathParts[0]]; ok {
+			return cc.findInCaliber(killer, childCaliber, nextPathParts)
+		} else {
+			return nil
+		}
+	case CALIBER_KIND_SESSION:
+		return caliber
+	case CALIBER_KIND_SIMPLES:
+		return nil
+	default:
+		return caliber
+	}
+}
+
+// findValue resolve a param path such as session.login to a value for a
+// killer, picking the killer's session the first time one is referenced
+func (cc *CallCollection) findValue(killer *Killer, unit string) (string, bool) {
+	cc.run.log("find caliber by unit - %v", unit)
+	// Variables extracted from responses come first
+	if value, ok := killer.getVar(unit); ok {
+		return value, true
+	}
+	caliber := cc.findCaliber(killer, unit)
+	if caliber != nil && caliber.kind == CALIBER_KIND_SESSION {
+		if killer.session == nil {
+			calibers := caliber.feature.description.(CaliberList)
+			killer.session = calibers[killer.rand.Intn(len(calibers))]
+		}
+		caliber = cc.findInCaliber(
+			killer,
+			killer.session,
+			cc.getNextPathParts(strings.Split(unit, ".")),
+		)
+	}
+	if caliber != nil {
+		return caliber.feature.String(killer), true
+	}
+	return "", false
+}
+
+func (cc *CallCollection) getNextPathParts(pathParts []string) []string {
+	if len(pathParts) > 1 {
+		return pathParts[1:]
+	} else {
+		return pathParts
+	}
+}
+
+type CaliberList []*Caliber
+type CaliberMap map[string]*Caliber
+type CaliberMapList []CaliberMap
+
+func (cm CaliberMap) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	calibers := make(map[interface{}]interface{})
+	err := unmarshal(calibers)
+
+	if rawSessions, ok := calibers["session"].([]interface{}); ok {
+		delete(calibers, "session")
+		list := make(CaliberList, 0)
+
+		for _, rawSession := range rawSessions {
+			if session, ok := rawSession.(map[interface{}]interface{}); ok {
+				caliberMap := make(CaliberMap)
+				caliberMap.fill(session)
+				list = append(list, NewCaliberByKindAndFeature(CALIBER_KIND_MAP, NewDescribedFeature(caliberMap)))
+			}
+		}
+		cm["session"] = NewCaliberByKindAndFeature(CALIBER_KIND_SESSION, NewDescribedFeature(list))
+	}
+
+	cm.fill(calibers)
+	return err
+}
+
+func (cm CaliberMap) fill(rawCalibers map[interface{}]interface{}) {
+	for rawKey, rawValue := range rawCalibers {
+		var caliber *Caliber
+		key := fmt.Sprintf("%v", rawKey)
+
+		switch rawValue.(type) {
+		case []interface{}:
+			if arrayParamRegexp.MatchString(key) {
+				caliber = NewCaliberByKindAndFeature(CALIBER_KIND_SIMPLES, NewDescribedFeature(rawValue))
+			} else {
+				list := make(CaliberList, 0)
+				list.fill(rawValue.([]interface{}))
+				caliber = NewCaliberByKindAndFeature(CALIBER_KIND_LIST, NewDescribedFeature(list))
+			}
+			break
+		case map[interface{}]interface{}:
+			caliberMap := make(CaliberMap)
+			caliberMap.fill(rawValue.(map[interface{}]interface{}))
+			caliber = NewCaliberByKindAndFeature(CALIBER_KIND_MAP, NewDescribedFeature(caliberMap))
+			break
+		default:
+			caliber = NewCaliberByKindAndFeature(CALIBER_KIND_SIMPLE, NewDescribedFeature(rawValue))
+			break
+		}
+		cm[key] = caliber
+	}
+}
+
+func (cl *CaliberList) fill(rawList []interface{}) {
+	for _, value := range rawList {
+		switch value.(type) {
+		case []interface{}:
+			list := make(CaliberList, 0)
+			list.fill(value.([]interface{}))
+			*cl = append(*cl, NewCaliberByKindAndFeature(CALIBER_KIND_LIST, NewDescribedFeature(list)))
+			break
+		case map[interface{}]interface{}:
+			caliberMap := make(CaliberMap)
+			caliberMap.fill(value.(map[interface{}]interface{}))
+			*cl = append(*cl, NewCaliberByKindAndFeature(CALIBER_KIND_MAP, NewDescribedFeature(caliberMap)))
+			break
+		default:
+			*cl = append(*cl, NewCaliberByKindAndFeature(CALIBER_KIND_SIMPLE, NewDescribedFeature(value)))
+			break
+		}
+	}
+}
+
+type Caliber struct {
+	kind     CaliberKind
+	feature  *Feature
+	children interface{}
+}
+
+func NewCaliber() *Caliber {
+	return new(Caliber)
+}
+
+func NewCaliberByKind(kind CaliberKind) *Caliber {
+	caliber := NewCaliber()
+	caliber.kind = kind
+	return caliber
+}
+
+func NewCaliberByKindAndFeature(kind CaliberKind, feature *Feature) *Caliber {
+	caliber := NewCaliberByKind(kind)
+	caliber.feature = feature
+	return caliber
+}
+
+type CaliberKind int
+
+const (
+	CALIBER_KIND_SIMPLE CaliberKind = iota
+	CALIBER_KIND_SIMPLES
+	CALIBER_KIND_MAP
+	CALIBER_KIND_LIST
+	CALIBER_KIND_SESSION
+)
+
+type Cartridges []*Cartridge
+
+func (c *Cartridges) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	rawCartridges := make([]interface{}, 0)
+	err := unmarshal(&rawCartridges)
+
+	if err != nil {
+		return err
+	}
+
+	return c.fill(rawCartridges)
+}
+
+func (c *Cartridges) fill(rawCartridges []interface{}) error {
+	for _, rawCartridge := range rawCartridges {
+		cartridge := &Cartridge{
+			successStatusCodes: []int{200, 301, 302},
+		}
+		for rawKey, rawValue := range rawCartridge.(map[interface{}]interface{}) {
+			key := rawKey.(string)
+			switch key {
+			case RANDOM_METHOD, SYNC_METHOD:
+				cartridge.path = NewNamedFeature(key)
+				cartridge.children = make(Cartridges, 0)
+				if err := cartridge.children.fill(rawValue.([]interface{})); err != nil {
+					return err
+				}
+				break
+			case REPEAT_METHOD, IF_METHOD, FOREACH_METHOD:
+				flow, err := NewFlow(key, rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.path = NewNamedFeature(key)
+				cartridge.flow = flow
+				break
+			case "do", "else":
+				rawChildren, ok := rawValue.([]interface{})
+				if !ok {
+					return fmt.Errorf("%s must be a list of requests", key)
+				}
+				children := make(Cartridges, 0)
+				if err := children.fill(rawChildren); err != nil {
+					return err
+				}
+				if key == "do" {
+					cartridge.children = children
+				} else {
+					cartridge.elseChildren = children
+				}
+				break
+			case "extract":
+				rawExtractors, ok := rawValue.(map[interface{}]interface{})
+				if !ok {
+					return fmt.Errorf("extract must be a map")
+				}
+				extractors, err := NewExtractors(rawExtractors)
+				if err != nil {
+					return err
+				}
+				cartridge.extractors = extractors
+				break
+			case INCLUDE_METHOD:
+				// The file is read once the whole configuration has been read,
+				// and its requests run in order, as if written in place
+				cartridge.path = NewNamedFeature(SYNC_METHOD)
+				cartridge.include = rawValue
+				break
+			case "headers":
+				cartridge.bulletFeatures = make(Features, 0)
+				cartridge.bulletFeatures.fill(rawValue.(map[interface{}]interface{}))
+				break
+			case "params":
+				cartridge.chargeFeatures = make(Features, 0)
+				cartridge.chargeFeatures.fill(rawValue.(map[interface{}]interface{}))
+				break
+			case "body":
+				body, err := NewBody(rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.body = body
+				break
+			case "files":
+				rawFiles, ok := rawValue.([]interface{})
+				if !ok {
+					return fmt.Errorf("files must be a list")
+				}
+				files, err := NewUploadFiles(rawFiles)
+				if err != nil {
+					return err
+				}
+				cartridge.files = files
+				break
+			case "auth":
+				auth, err := NewAuth(rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.auth = auth
+				break
+			case "signing":
+				signing, err := NewSigning(rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.signing = signing
+				break
+			case "picks":
+				picks, ok := rawValue.(int)
+				if !ok || picks < 0 {
+					return fmt.Errorf("picks must be a positive number")
+				}
+				cartridge.picks = picks
+				break
+			case "weight":
+				weight, ok := toFloat(rawValue)
+				if !ok || weight <= 0 {
+					return fmt.Errorf("weight must be a positive number")
+				}
+				cartridge.weight = weight
+				break
+			case "probability":
+				probability, ok := toFloat(rawValue)
+				if !ok || probability <= 0 || probability > 1 {
+					return fmt.Errorf("probability must be above 0 and at most 1")
+				}
+				cartridge.probability = probability
+				break
+			case "retry":
+				retry, err := NewRetry(rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.retry = retry
+				break
+			case "think":
+				think, err := NewThink(rawValue)
+				if err != nil {
+					return err
+				}
+				cartridge.think = think
+				break
+			case "timeout":
+				cartridge.timeout = time.Duration(rawValue.(int))
+				break
+				//			case "successStatusCodes":
+				//				cartridge.timeout = time.Duration(rawValue.(int))
+				//				break;
+				//			case "failedStatusCodes":
+				//				cartridge.timeout = time.Duration(rawValue.(int))
+				//				break;
+			default:
+				// Any other upper case key is taken to be the request method,
+				// so GET, PATCH, HEAD, OPTIONS or custom verbs all work
+				if methodRegexp.MatchString(key) {
+					cartridge.path = NewNamedDescribedFeature(key, rawValue)
+					cartridge.path.rawDescription = rawValue
+				}
+				break
+			}
+		}
+		if cartridge.flow != nil && len(cartridge.children) == 0 {
+			return fmt.Errorf("%s needs a do list of requests", cartridge.getMethod())
+		}
+		*c = append(*c, cartridge)
+	}
+	return nil
+}
+
+func (c *Cartridges) getCodes(rawCodes interface{}) []int {
+	switch rawCodes.(type) {
+	case []interface{}:
+		codes := make([]int, 0)
+		for _, rawCode := range rawCodes.([]interface{}) {
+			codes = append(codes, rawCode.(int))
+		}
+		return codes
+	default:
+		return []int{rawCodes.(int)}
+	}
+}
+
+func (c Cartridges) toPlainSlice() Cartridges {
+	cartridges := make(Cartridges, 0)
+	for _, cartridge := range c {
+		if cartridge.isGroup() {
+			cartridges = append(cartridges, cartridge.children.toPlainSlice()...)
+			cartridges = append(cartridges, cartridge.elseChildren.toPlainSlice()...)
+		} else {
+			cartridges = append(cartridges, cartridge)
+		}
+	}
+	return cartridges
+}
+
+const (
+	GET_METHOD     = "GET"
+	POST_METHOD    = "POST"
+	PUT_METHOD     = "PUT"
+	DELETE_METHOD  = "DELETE"
+	RANDOM_METHOD  = "RANDOM"
+	SYNC_METHOD    = "SYNC"
+	INCLUDE_METHOD = "INCLUDE"
+	REPEAT_METHOD  = "REPEAT"
+	IF_METHOD      = "IF"
+	FOREACH_METHOD = "FOREACH"
+)
+
+type Cartridge struct {
+	id               int
+	path             *Feature
+	bulletFeatures   Features
+	chargeFeatures   Features
+	body             *Body
+	files            []*UploadFile
+	auth             *Auth
+	signing          *Signing
+	include          interface{}
+	includedCalibers CaliberMap
+	// files were read and ids given, as vu_setup may be shared by scenarios
+	prepared           bool
+	timeout            time.Duration
+	successStatusCodes []int
+	failedStatusCodes  []int
+	children           Cartridges
+	phase              string
+	elseChildren       Cartridges
+	flow               *Flow
+	extractors         []*Extractor
+	think              *Think
+	retry              *Retry
+	picks              int
+	weight             float64
+	probability        float64
+}
+
+func (c *Cartridge) getMethod() string {
+	return c.path.name
+}
+
+// isGroup check whether a cartridge holds other cartridges rather than being
+// a request
+func (c *Cartridge) isGroup() bool {
+	switch c.getMethod() {
+	case RANDOM_METHOD, SYNC_METHOD, REPEAT_METHOD, IF_METHOD, FOREACH_METHOD:
+		return true
+	}
+	return false
+}
+
+func (c *Cartridge) getPathAsString(killer *Killer) string {
+	return c.path.String(killer)
+}
+
+// getChildren get the children of a group in the order they run. SYNC runs
+// every child in order. RANDOM by default runs every child once in a random
+// order. With picks or child weights it samples picks children (default the
+// number of children) with replacement, in proportion to their weights, so
+// some may run several times and some not at all. Without those, children
+// with a probability run only with that probability. Random draws come from
+// the killer's own source.
+func (c *Cartridge) getChildren(killer *Killer) Cartridges {
+	if c.path.name == RANDOM_METHOD {
+		if c.isWeighted() {
+			return c.sampleChildren(killer)
+		}
+		shuffleChildren := make(Cartridges, 0, len(c.children))
+		indexes := killer.rand.Perm(len(c.children))
+		for _, i := range indexes {
+			child := c.children[i]
+			if child.probability > 0 && killer.rand.Float64() >= child.probability {
+				continue
+			}
+			shuffleChildren = append(shuffleChildren, child)
+		}
+		return shuffleChildren
+	} else if c.path.name == SYNC_METHOD {
+		return c.children
+	} else {
+		return Cartridges{}
+	}
+}
+
+func (c *Cartridge) isWeighted() bool {
+	if c.picks > 0 {
+		return true
+	}
+	for _, child := range c.children {
+		if child.weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleChildren pick children with replacement in proportion to their weights
+func (c *Cartridge) sampleChildren(killer *Killer) Cartridges {
+	picks := c.picks
+	if picks == 0 {
+		picks = len(c.children)
+	}
+	totalWeight := 0.0
+	for _, child := range c.children {
+		totalWeight += child.getWeight()
+	}
+	sampledChildren := make(Cartridges, 0, picks)
+	for i := 0; i < picks; i++ {
+		n := killer.rand.Float64() * totalWeight
+		for _, child := range c.children {
+			n -= child.getWeight()
+			if n < 0 {
+				sampledChildren = append(sampledChildren, child)
+				break
+			}
+		}
+	}
+	return sampledChildren
+}
+
+func (c *Cartridge) getWeight() float64 {
+	if c.weight > 0 {
+		return c.weight
+	}
+	return 1
+}
+
+// getExpectedCount get the number of requests a run of the cartridges is
+// expected to make, on average for RANDOM groups
+func (c Cartridges) getExpectedCount() float64 {
+	count := 0.0
+	for _, cartridge := range c {
+		switch cartridge.getMethod() {
+		case SYNC_METHOD:
+			count += cartridge.children.getExpectedCount()
+		case REPEAT_METHOD, IF_METHOD, FOREACH_METHOD:
+			count += float64(cartridge.flow.getExpectedIterations()) * cartridge.children.getExpectedCount()
+		case RANDOM_METHOD:
+			if cartridge.isWeighted() {
+				picks := cartridge.picks
+				if picks == 0 {
+					picks = len(cartridge.children)
+				}
+				totalWeight, weightedCount := 0.0, 0.0
+				for _, child := range cartridge.children {
+					totalWeight += child.getWeight()
+					weightedCount += child.getWeight() * Cartridges{child}.getExpectedCount()
+				}
+				count += float64(picks) * weightedCount / totalWeight
+			} else {
+				for _, child := range cartridge.children {
+					childCount := Cartridges{child}.getExpectedCount()
+					if child.probability > 0 {
+						childCount *= child.probability
+					}
+					count += childCount
+				}
+			}
+		default:
+			count++
+		}
+	}
+	return count
+}
+
+type FeatureKind int
+
+const (
+	FEATURE_KIND_SIMPLE FeatureKind = iota
+	FEATURE_KIND_MULTIPLE
+)
+
+type Features []*Feature
+
+func (f *Features) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	rawFeatures := make(map[interface{}]interface{})
+	err := unmarshal(&rawFeatures)
+
+	f.fill(rawFeatures)
+
+	return err
+}
+
+func (f *Features) fill(rawFeatures map[interface{}]interface{}) {
+	for rawKey, rawValue := range rawFeatures {
+		key := rawKey.(string)
+		value := fmt.Sprintf("%v", rawValue)
+		*f = append(*f, NewNamedDescribedFeature(key, value))
+	}
+}
+
+type Feature struct {
+	name           string
+	description    interface{}
+	rawDescription interface{}
+	units          []string
+	kind           FeatureKind
+}
+
+func NewFeature() *Feature {
+	return new(Feature)
+}
+
+func NewNamedFeature(name string) *Feature {
+	feature := NewFeature()
+	feature.name = name
+	return feature
+}
+
+func NewDescribedFeature(rawDescription interface{}) *Feature {
+	return NewFeature().setDescription(rawDescription)
+}
+
+func NewNamedDescribedFeature(name string, rawDescription interface{}) *Feature {
+	return NewNamedFeature(name).setDescription(rawDescription)
+}
+
+func (f *Feature) setDescription(rawDescription interface{}) *Feature {
+	switch rawDescription.(type) {
+	case string:
+		description := rawDescription.(string)
+		if configParamRegexp.MatchString(description) {
+			f.description = configParamRegexp.ReplaceAllString(description, "%v")
+			f.units = make([]string, 0)
+			for _, submatches := range configParamRegexp.FindAllStringSubmatch(description, -1) {
+				if len(submatches) >= 2 {
+					f.units = append(f.units, submatches[1])
+				}
+			}
+			f.kind = FEATURE_KIND_MULTIPLE
+		} else {
+			f.setSimpleDescription(description)
+		}
+		break
+	default:
+		f.setSimpleDescription(rawDescription)
+		break
+	}
+	return f
+}
+
+func (f *Feature) setSimpleDescription(description interface{}) *Feature {
+	f.description = description
+	f.kind = FEATURE_KIND_SIMPLE
+	return f
+}
+
+func (f *Feature) String(killer *Killer) string {
+	if f.kind == FEATURE_KIND_SIMPLE {
+		return fmt.Sprintf("%v", f.description)
+	}
+	values := make([]interface{}, len(f.units))
+	for i, unit := range f.units {
+		if value, ok := killer.getCallCollection().findValue(killer, unit); ok {
+			values[i] = value
+		}
+	}
+	return fmt.Sprintf(f.description.(string), values...)
+}
+
+// toFloat get a number from a raw yaml value
+func toFloat(rawValue interface{}) (float64, bool) {
+	switch value := rawValue.(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRandomGroupSampling(t *testing.T) {
+	var cartridges Cartridges
+	err := yaml.Unmarshal([]byte(`
+- RANDOM:
+  - GET: /heavy
+    weight: 9
+  - GET: /light
+    weight: 1
+  picks: 4
+`), &cartridges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := cartridges[0]
+	killer := &Killer{rand: rand.New(rand.NewSource(1))}
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		children := group.getChildren(killer)
+		if len(children) != 4 {
+			t.Fatalf("got %d children, want 4 picks", len(children))
+		}
+		for _, child := range children {
+			counts[child.path.rawDescription.(string)]++
+		}
+	}
+	// 4000 picks at 90% should be far from an even split
+	if counts["/heavy"] < 3400 || counts["/light"] < 200 {
+		t.Errorf("got counts %v", counts)
+	}
+
+	if expected := cartridges.getExpectedCount(); expected != 4 {
+		t.Errorf("got expected count %v, want 4", expected)
+	}
+}
+
+func TestRandomGroupProbability(t *testing.T) {
+	var cartridges Cartridges
+	err := yaml.Unmarshal([]byte(`
+- RANDOM:
+  - GET: /sometimes
+    probability: 0.5
+  - GET: /always
+`), &cartridges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	killer := &Killer{rand: rand.New(rand.NewSource(1))}
+	sometimes := 0
+	for i := 0; i < 1000; i++ {
+		children := cartridges[0].getChildren(killer)
+		if len(children) == 2 {
+			sometimes++
+		}
+	}
+	if sometimes < 350 || sometimes > 650 {
+		t.Errorf("got %d of 1000 runs with the optional request", sometimes)
+	}
+	if expected := cartridges.getExpectedCount(); expected != 1.5 {
+		t.Errorf("got expected count %v, want 1.5", expected)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	run, err := NewRun([]byte(`
+host: example.com
+requests:
+  - PATCH: /items/1
+    params:
+      name: patched
+  - PUT: /items/1
+    body: '{"name": "put"}'
+    headers:
+      Content-Type: application/json
+  - HEAD: /items
+  - OPTIONS: /items
+  - PURGE: /cache
+  - M-SEARCH: /
+  - GET: /search
+    params:
+      q: mgun
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	killer := run.attack.newPhaseKiller(context.Background(), context.Background())
+
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{"PATCH", "name=patched"},
+		{"PUT", `{"name": "put"}`},
+		{"HEAD", ""},
+		{"OPTIONS", ""},
+		{"PURGE", ""},
+		{"M-SEARCH", ""},
+		{"GET", "q=mgun"},
+	}
+	cartridges := run.collection.Cartridges
+	if len(cartridges) != len(tests) {
+		t.Fatalf("got %d requests, want %d", len(cartridges), len(tests))
+	}
+	for i, test := range tests {
+		shot, err := killer.load(cartridges[i])
+		if err != nil {
+			t.Fatalf("%s: %v", test.method, err)
+		}
+		if shot.request.Method != test.method {
+			t.Errorf("got method %s, want %s", shot.request.Method, test.method)
+		}
+		var body []byte
+		if shot.request.Body != nil {
+			body, _ = ioutil.ReadAll(shot.request.Body)
+		}
+		if string(body) != test.body || shot.request.ContentLength != int64(len(test.body)) {
+			t.Errorf("%s: got body %q of length %d, want %q", test.method, body, shot.request.ContentLength, test.body)
+		}
+	}
+
+	var lower Cartridges
+	if err := yaml.Unmarshal([]byte(`[{get: /}]`), &lower); err != nil {
+		t.Fatal(err)
+	}
+	if lower[0].path != nil {
+		t.Error("expected a lower case key not to be taken as a method")
+	}
+}
+
+func TestFindValueDrawsFromKiller(t *testing.T) {
+	collection := &CallCollection{run: &Run{reporter: new(Reporter)}, Calibers: make(CaliberMap)}
+	err := yaml.Unmarshal([]byte(`
+params:
+  word: [a, b, c, d, e, f, g, h]
+  session:
+    - login: one
+    - login: two
+    - login: three
+`), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Killers with sources seeded alike draw the same values, whatever the
+	// time they look them up at
+	draw := func() string {
+		killer := &Killer{callCollection: collection, rand: rand.New(rand.NewSource(7))}
+		values := ""
+		for i := 0; i < 20; i++ {
+			value, _ := collection.findValue(killer, "word")
+			values += value
+		}
+		login, ok := collection.findValue(killer, "session.login")
+		if !ok || len(login) == 0 {
+			t.Fatal("expected a session login")
+		}
+		return values + " " + login
+	}
+	if first, second := draw(), draw(); first != second {
+		t.Errorf("got %s and %s, want the draws of the killer's source", first, second)
+	}
+}
@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	tm "github.com/buger/goterm"
+	"go.uber.org/ratelimit"
+)
+
+// CAPACITY_MIN_THROUGHPUT the share of the rate a step has to reach, below
+// which the target or the virtual users could not keep up with it
+const CAPACITY_MIN_THROUGHPUT = 0.9
+
+// Capacity how the highest rate a target sustains within its SLOs is
+// searched for. Every step is a run of its own at a rate, setup and teardown
+// included, whose requests are checked once the warmup is over.
+//
+// With a step the rate goes up by it until a step fails. Without one the rate
+// doubles until a step fails, and the rates between the last passing and the
+// first failing ones are then searched in halves, until they are precision
+// apart, or 5% of the passing rate when it is 0.
+type Capacity struct {
+	Start     int
+	Max       int
+	Step      int
+	Precision int
+	Duration  time.Duration
+	Warmup    time.Duration
+	// SLOs, the 95th percentile of the response time and the share of
+	// failed requests in percent
+	P95       time.Duration
+	ErrorRate float64
+}
+
+// CapacityStep the results of a step of a capacity search
+type CapacityStep struct {
+	Rate       int
+	Requests   int
+	Errors     int
+	Throughput float64
+	P95        time.Duration
+	// why the step did not pass, empty if it did
+	Failure string
+}
+
+// validate check the settings of a capacity search
+func (c *Capacity) validate() error {
+	if c.Start < 1 {
+		return fmt.Errorf("capacity start rate must be at least 1")
+	}
+	if c.Max < c.Start {
+		return fmt.Errorf("capacity max rate must not be below the start rate")
+	}
+	if c.Step < 0 || c.Precision < 0 {
+		return fmt.Errorf("capacity step and precision must not be negative")
+	}
+	if c.Duration <= 0 || c.Warmup < 0 {
+		return fmt.Errorf("capacity step duration must be positive")
+	}
+	if c.P95 <= 0 || c.ErrorRate < 0 {
+		return fmt.Errorf("capacity SLOs must be positive")
+	}
+	return nil
+}
+
+// getPrecision get how close the bounds of the search in halves get
+func (c *Capacity) getPrecision(passing int) int {
+	if c.Precision > 0 {
+		return c.Precision
+	}
+	return int(math.Max(1, float64(passing)/20))
+}
+
+// search find the highest rate that passes, or 0 if none does
+func (c *Capacity) search(try func(rate int) bool) int {
+	passing, failing := 0, 0
+	for rate := c.Start; rate <= c.Max; {
+		if !try(rate) {
+			failing = rate
+			break
+		}
+		passing = rate
+
+		next := rate * 2
+		if c.Step > 0 {
+			next = rate + c.Step
+		}
+		// The max rate is tried rather than stepped over
+		if rate < c.Max && next > c.Max {
+			next = c.Max
+		}
+		rate = next
+	}
+	if c.Step > 0 || failing == 0 {
+		return passing
+	}
+	for failing-passing > c.getPrecision(passing) {
+		rate := (passing + failing) / 2
+		if try(rate) {
+			passing = rate
+		} else {
+			failing = rate
+		}
+	}
+	return passing
+}
+
+// check set why a step failed its SLOs, if it did
+func (s *CapacityStep) check(c *Capacity) {
+	errorRate := 0.0
+	if s.Requests > 0 {
+		errorRate = float64(s.Errors) * 100 / float64(s.Requests)
+	}
+	switch {
+	case s.Requests == 0:
+		s.Failure = "no requests"
+	case errorRate > c.ErrorRate:
+		s.Failure = fmt.Sprintf("errors %.2f%%", errorRate)
+	case s.P95 > c.P95:
+		s.Failure = fmt.Sprintf("p95 %v", s.P95.Round(time.Millisecond))
+	case s.Throughput < float64(s.Rate)*CAPACITY_MIN_THROUGHPUT:
+		s.Failure = fmt.Sprintf("throughput %.2f/s", s.Throughput)
+	}
+}
+
+// FindCapacity search for the highest rate the target sustains within the
+// SLOs of a capacity search, and report every step. When the context is done
+// the search stops, a step cut short not counting, and the steps made until
+// then are reported as interrupted.
+func (a *Attack) FindCapacity(ctx context.Context, capacity *Capacity) error {
+	if err := capacity.validate(); err != nil {
+		return err
+	}
+	// The rate of every step would be overridden by a scenario's own rate
+	for _, scenario := range a.scenarios {
+		if scenario.Rate > 0 {
+			return fmt.Errorf("scenario %s has a ratepersecond of its own, remove it to search for capacity", scenario.name)
+		}
+	}
+	a.run.setCapacitySearch()
+	a.run.ln()
+	a.run.log("find capacity")
+	defer a.run.closeMetrics(ctx)
+	if pusher := a.run.startPush(); pusher != nil {
+		defer pusher.stop()
+	}
+
+	steps := make([]*CapacityStep, 0)
+	highest := capacity.search(func(rate int) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		fmt.Printf("Step %d: %d requests per second for %v\n", len(steps)+1, rate, capacity.Warmup+capacity.Duration)
+		step := a.runCapacityStep(ctx, capacity, rate)
+		if ctx.Err() != nil {
+			return false
+		}
+		steps = append(steps, step)
+		return len(step.Failure) == 0
+	})
+	a.run.reporter.reportCapacity(steps, highest, ctx.Err() != nil)
+	return nil
+}
+
+// runCapacityStep run the virtual users at a rate for a step, measuring the
+// requests sent in its steady window. Phases and retried attempts are left out.
+func (a *Attack) runCapacityStep(ctx context.Context, capacity *Capacity, rate int) *CapacityStep {
+	a.run.limiter = ratelimit.New(rate, ratelimit.WithoutSlack)
+	ctx, cancel := context.WithTimeout(ctx, capacity.Warmup+capacity.Duration)
+	defer cancel()
+
+	windowStart := time.Now().Add(capacity.Warmup)
+	windowEnd := windowStart.Add(capacity.Duration)
+	step := &CapacityStep{Rate: rate}
+	durations := NewHistogram()
+	a.launch(ctx, 0, false, func(hits <-chan *Hit) {
+		for hit := range hits {
+			if a.run.metrics != nil {
+				a.run.metrics.add(hit)
+			}
+			if a.run.pusher != nil {
+				a.run.pusher.add(hit)
+			}
+			if hit.retried || len(hit.shot.cartridge.phase) > 0 {
+				continue
+			}
+			if hit.startTime.Before(windowStart) || !hit.startTime.Before(windowEnd) {
+				continue
+			}
+			step.Requests++
+			if !hit.isSuccess() {
+				step.Errors++
+			}
+			durations.record(hit.endTime.Sub(hit.startTime))
+		}
+	})
+
+	step.P95 = durations.percentile(95)
+	step.Throughput = float64(step.Requests) / capacity.Duration.Seconds()
+	step.check(capacity)
+	return step
+}
+
+// reportCapacity print the steps of a capacity search and the highest rate
+// that passed, noting when the search was interrupted
+func (r *Reporter) reportCapacity(steps []*CapacityStep, highest int, interrupted bool) {
+	table := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "Step\tRate\tRequests\tThroughput\tp95\tErrors\tResult\n")
+	for i, step := range steps {
+		result := "pass"
+		if len(step.Failure) > 0 {
+			result = "fail, " + step.Failure
+		}
+		fmt.Fprintf(
+			table, "%d.\t%d\t%d\t%.2f\t%v\t%d\t%s\n",
+			i+1,
+			step.Rate,
+			step.Requests,
+			step.Throughput,
+			step.P95.Round(time.Millisecond),
+			step.Errors,
+			result,
+		)
+	}
+	summary := "No rate passed"
+	if highest > 0 {
+		summary = fmt.Sprintf("Highest passing rate: %d requests per second", highest)
+	}
+	if interrupted {
+		summary = "Interrupted. " + summary
+	}
+
+	fmt.Println(EmptySign)
+	fmt.Println(table)
+	fmt.Println(summary)
+
+	if r.Output != "" {
+		var b strings.Builder
+		fmt.Fprintln(&b, table)
+		fmt.Fprintln(&b, summary)
+		r.writeOutput(b.String())
+	}
+}
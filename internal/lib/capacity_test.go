@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapacitySearch(t *testing.T) {
+	checks := []struct {
+		capacity Capacity
+		limit    int
+		want     int
+		tried    []int
+	}{
+		{Capacity{Start: 10, Max: 1000, Precision: 5}, 50, 50, []int{10, 20, 40, 80, 60, 50, 55}},
+		{Capacity{Start: 10, Max: 100, Step: 10}, 35, 30, []int{10, 20, 30, 40}},
+		{Capacity{Start: 10, Max: 30}, 100, 30, []int{10, 20, 30}},
+		{Capacity{Start: 10, Max: 100}, 0, 0, []int{10, 5, 2, 1}},
+	}
+	for i, check := range checks {
+		tried := make([]int, 0)
+		got := check.capacity.search(func(rate int) bool {
+			tried = append(tried, rate)
+			return rate <= check.limit
+		})
+		if got != check.want {
+			t.Errorf("search %d: got %d, want %d", i, got, check.want)
+		}
+		if len(tried) != len(check.tried) {
+			t.Errorf("search %d: tried %v, want %v", i, tried, check.tried)
+			continue
+		}
+		for j := range tried {
+			if tried[j] != check.tried[j] {
+				t.Errorf("search %d: tried %v, want %v", i, tried, check.tried)
+				break
+			}
+		}
+	}
+}
+
+func TestCapacityStep(t *testing.T) {
+	capacity := &Capacity{P95: 100 * time.Millisecond, ErrorRate: 1}
+	durations := NewHistogram()
+	for i := 1; i <= 100; i++ {
+		durations.record(time.Duration(i) * time.Millisecond)
+	}
+	if p95 := durations.percentile(95).Round(time.Millisecond); p95 != 95*time.Millisecond {
+		t.Errorf("got p95 %v, want 95ms", p95)
+	}
+
+	steps := map[string]CapacityStep{
+		"":                  {Rate: 10, Requests: 100, Throughput: 10, P95: 95 * time.Millisecond},
+		"errors 2.00%":      {Rate: 10, Requests: 100, Errors: 2, Throughput: 10},
+		"p95 150ms":         {Rate: 10, Requests: 100, Throughput: 10, P95: 150 * time.Millisecond},
+		"throughput 8.00/s": {Rate: 10, Requests: 80, Throughput: 8},
+		"no requests":       {Rate: 10},
+	}
+	for want, step := range steps {
+		step.check(capacity)
+		if step.Failure != want {
+			t.Errorf("got failure %q, want %q", step.Failure, want)
+		}
+	}
+}
+
+func TestCapacityScenarioRate(t *testing.T) {
+	run, err := NewRun([]byte(`
+host: localhost
+concurrency: 2
+scenarios:
+  browse:
+    requests:
+      - GET: /catalog
+  admin:
+    ratepersecond: 5
+    requests:
+      - GET: /admin
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capacity := &Capacity{Start: 10, Max: 100, Duration: time.Second, P95: time.Second, ErrorRate: 1}
+	err = run.Attack().FindCapacity(context.Background(), capacity)
+	if err == nil || !strings.Contains(err.Error(), "scenario admin") {
+		t.Errorf("got error %v, want the rate of scenario admin refused", err)
+	}
+}
@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	configExtendsKey      = "extends"
+	configIncludeKey      = "include"
+	configEnvironmentsKey = "environments"
+)
+
+// LoadConfig read a configuration file and compose it with the files it
+// extends and the named environment, returning yaml ready to be unmarshalled.
+//
+// extends (or include) names one or more files, relative to the file naming
+// them, that are deep merged in order before the file itself: maps are merged
+// key by key while other values, lists included, are replaced. Files that the
+// requests of a base include, send or upload stay relative to the base.
+// environments maps names such as staging or prod to overlays merged on top
+// of the result when that environment is selected.
+func LoadConfig(path string, environment string) ([]byte, error) {
+	config, err := loadConfigMap(path, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	environments, _ := config[configEnvironmentsKey].(map[interface{}]interface{})
+	delete(config, configEnvironmentsKey)
+	if len(environment) > 0 {
+		overlay, ok := environments[environment].(map[interface{}]interface{})
+		if !ok {
+			names := make([]string, 0, len(environments))
+			for name := range environments {
+				names = append(names, fmt.Sprintf("%v", name))
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("environment %s not found, available: %s", environment, strings.Join(names, ", "))
+		}
+		config = mergeConfigMaps(config, overlay)
+	}
+
+	return yaml.Marshal(config)
+}
+
+func loadConfigMap(path string, seen []string) (map[interface{}]interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, seenPath := range seen {
+		if seenPath == absPath {
+			return nil, fmt.Errorf("configuration %s extends itself", path)
+		}
+	}
+	isBase := len(seen) > 0
+	seen = append(seen, absPath)
+
+	data, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	// Files named by the requests of a base are relative to the base, not to
+	// the file extending it
+	if isBase {
+		rebaseConfigPaths(config, filepath.Dir(absPath))
+	}
+
+	bases := make([]string, 0)
+	for _, key := range []string{configExtendsKey, configIncludeKey} {
+		switch value := config[key].(type) {
+		case string:
+			bases = append(bases, value)
+		case []interface{}:
+			for _, base := range value {
+				bases = append(bases, fmt.Sprintf("%v", base))
+			}
+		}
+		delete(config, key)
+	}
+
+	merged := make(map[interface{}]interface{})
+	for _, base := range bases {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(absPath), base)
+		}
+		baseConfig, err := loadConfigMap(base, seen)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeConfigMaps(merged, baseConfig)
+	}
+	return mergeConfigMaps(merged, config), nil
+}
+
+// mergeConfigMaps deep merge overlay into base, returning a new map
+func mergeConfigMaps(base, overlay map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		overlayMap, isMap := value.(map[interface{}]interface{})
+		baseMap, baseIsMap := merged[key].(map[interface{}]interface{})
+		if isMap && baseIsMap {
+			merged[key] = mergeConfigMaps(baseMap, overlayMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// rebaseConfigPaths make the relative paths of included files, bodies and
+// uploads in a configuration absolute, against the directory of its file
+func rebaseConfigPaths(config map[interface{}]interface{}, dir string) {
+	for _, key := range []string{"requests", "setup", "vu_setup", "teardown"} {
+		if rawRequests, ok := config[key].([]interface{}); ok {
+			rebaseRequestPaths(rawRequests, dir)
+		}
+	}
+	for _, key := range []string{"scenarios", configEnvironmentsKey} {
+		if rawMap, ok := config[key].(map[interface{}]interface{}); ok {
+			for _, value := range rawMap {
+				if nested, ok := value.(map[interface{}]interface{}); ok {
+					rebaseConfigPaths(nested, dir)
+				}
+			}
+		}
+	}
+}
+
+// rebaseRequestPaths make the relative paths of a list of requests absolute
+func rebaseRequestPaths(rawRequests []interface{}, dir string) {
+	rebase := func(path string) string {
+		if len(path) == 0 || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	for _, rawRequest := range rawRequests {
+		request, ok := rawRequest.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for rawKey, rawValue := range request {
+			switch rawKey {
+			case INCLUDE_METHOD:
+				switch value := rawValue.(type) {
+				case string:
+					request[rawKey] = rebase(value)
+				case map[interface{}]interface{}:
+					if file, ok := value["file"].(string); ok {
+						value["file"] = rebase(file)
+					}
+				}
+			case "body":
+				switch value := rawValue.(type) {
+				case string:
+					if strings.HasPrefix(value, "@") {
+						request[rawKey] = "@" + rebase(strings.TrimPrefix(value, "@"))
+					}
+				case map[interface{}]interface{}:
+					if file, ok := value["file"].(string); ok {
+						value["file"] = rebase(file)
+					}
+				}
+			case "files":
+				rawFiles, _ := rawValue.([]interface{})
+				for _, rawFile := range rawFiles {
+					if file, ok := rawFile.(map[interface{}]interface{}); ok {
+						if path, ok := file["path"].(string); ok {
+							file["path"] = rebase(path)
+						}
+					}
+				}
+			case RANDOM_METHOD, SYNC_METHOD, "do", "else":
+				if children, ok := rawValue.([]interface{}); ok {
+					rebaseRequestPaths(children, dir)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base/common.yaml": `
+concurrency: 10
+host: localhost
+headers:
+  X-Common: common
+  X-Overridden: base
+requests:
+  - GET: /
+`,
+		"scenario.yaml": `
+extends: base/common.yaml
+headers:
+  X-Overridden: scenario
+environments:
+  staging:
+    host: staging.example.com
+    ratepersecond: 50
+  prod:
+    host: example.com
+    scheme: https
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := LoadConfig(filepath.Join(dir, "scenario.yaml"), "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attack := new(Attack)
+	target := new(Target)
+	collection := new(CallCollection)
+	for _, v := range []interface{}{attack, target, collection} {
+		if err := yaml.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if attack.CallCollectionCount != 10 || attack.Rate != 50 {
+		t.Errorf("got concurrency %d and rate %d", attack.CallCollectionCount, attack.Rate)
+	}
+	if target.Host != "staging.example.com" {
+		t.Errorf("got host %s", target.Host)
+	}
+	headers := make(map[string]string)
+	for _, feature := range collection.Features {
+		headers[feature.name] = feature.description.(string)
+	}
+	if headers["X-Common"] != "common" || headers["X-Overridden"] != "scenario" {
+		t.Errorf("got headers %v", headers)
+	}
+	if len(collection.Cartridges) != 1 {
+		t.Errorf("got %d requests, want the base requests", len(collection.Cartridges))
+	}
+
+	if _, err := LoadConfig(filepath.Join(dir, "scenario.yaml"), "local"); err == nil {
+		t.Error("expected an error for an unknown environment")
+	}
+}
+
+func TestLoadConfigBasePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base/common.yaml": `
+requests:
+  - INCLUDE: fragments/login.yaml
+  - POST: /orders
+    body: "@payloads/order.json"
+`,
+		"base/fragments/login.yaml": `
+- POST: /login
+`,
+		"base/payloads/order.json": `{"id": 1}`,
+		"scenario.yaml": `
+extends: base/common.yaml
+host: localhost
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "scenario.yaml")
+	data, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := NewRun(data, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cartridges := run.collection.Cartridges
+	if len(cartridges) != 2 || len(cartridges[0].children) != 1 {
+		t.Fatalf("got %d requests, want the included login and the order", len(cartridges))
+	}
+	if got := cartridges[0].children[0].path.rawDescription; got != "/login" {
+		t.Errorf("got included request %v, want /login", got)
+	}
+	if got := string(cartridges[1].body.data); got != `{"id": 1}` {
+		t.Errorf("got body %s", got)
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	for _, path := range []string{"../../example.config.yaml", "../../cmd/mgun/internal/assets/example.config.yaml"} {
+		data, err := LoadConfig(path, "")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if _, err := NewRun(data, path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tm "github.com/buger/goterm"
+)
+
+const (
+	// DASHBOARD_HISTORY seconds of throughput and p95 the dashboard draws
+	DASHBOARD_HISTORY = 60
+	// DASHBOARD_ERRORS error messages the dashboard lists
+	DASHBOARD_ERRORS = 5
+)
+
+// sparks the bars of a sparkline, from lowest to highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// observer something that follows the hits of an attack as they arrive
+type observer interface {
+	add(hit *Hit)
+}
+
+// Dashboard a full screen view of an attack, redrawn every second with the
+// throughput, response times and errors of every request
+type Dashboard struct {
+	mutex   sync.Mutex
+	title   string
+	started time.Time
+	rows    map[int]*dashboardRow
+	// the requests of the load since the last refresh
+	window      *Histogram
+	windowStart time.Time
+	// the requests per second and the p95 in nanoseconds of the last seconds
+	throughput []float64
+	p95        []float64
+	errors     []string
+	requests   int
+	failures   int
+}
+
+// dashboardRow the statistics of a request on the dashboard
+type dashboardRow struct {
+	id       int
+	name     string
+	requests int
+	failures int
+	// requests per second over the last refresh
+	rate      float64
+	window    int
+	latencies *Histogram
+}
+
+// NewDashboard create the dashboard of an attack
+func NewDashboard(attack *Attack) *Dashboard {
+	return &Dashboard{
+		title:       fmt.Sprintf("mgun %s", attack.target.address()),
+		started:     time.Now(),
+		rows:        make(map[int]*dashboardRow),
+		window:      NewHistogram(),
+		windowStart: time.Now(),
+		throughput:  make([]float64, 0, DASHBOARD_HISTORY),
+		p95:         make([]float64, 0, DASHBOARD_HISTORY),
+		errors:      make([]string, 0, DASHBOARD_ERRORS),
+	}
+}
+
+// add count a hit of the load on the dashboard
+func (d *Dashboard) add(hit *Hit) {
+	cartridge := hit.shot.cartridge
+	if hit.retried || len(cartridge.phase) > 0 {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	row, ok := d.rows[cartridge.id]
+	if !ok {
+		row = &dashboardRow{
+			id:        cartridge.id,
+			name:      fmt.Sprintf("%s %s", cartridge.getMethod(), cartridge.path.rawDescription),
+			latencies: NewHistogram(),
+		}
+		d.rows[cartridge.id] = row
+	}
+	duration := hit.endTime.Sub(hit.startTime)
+	row.requests++
+	row.window++
+	row.latencies.record(duration)
+	d.requests++
+	d.window.record(duration)
+	if !hit.isSuccess() {
+		row.failures++
+		d.failures++
+		if len(d.errors) == DASHBOARD_ERRORS {
+			d.errors = d.errors[1:]
+		}
+		d.errors = append(d.errors, fmt.Sprintf("%s %s: %s", hit.endTime.Format("15:04:05"), row.name, hit.describeError()))
+	}
+}
+
+// refresh close the current second of the dashboard and draw it
+func (d *Dashboard) refresh(activeVUs int, virtualUsers int, width int) string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(d.windowStart).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(d.window.count()) / elapsed
+	}
+	if len(d.throughput) == DASHBOARD_HISTORY {
+		d.throughput = d.throughput[1:]
+		d.p95 = d.p95[1:]
+	}
+	d.throughput = append(d.throughput, rate)
+	d.p95 = append(d.p95, float64(d.window.percentile(95)))
+	for _, row := range d.rows {
+		row.rate = 0
+		if elapsed > 0 {
+			row.rate = float64(row.window) / elapsed
+		}
+		row.window = 0
+	}
+	d.window.reset()
+	d.windowStart = now
+
+	var b strings.Builder
+	errorRate := 0.0
+	if d.requests > 0 {
+		errorRate = float64(d.failures) * 100 / float64(d.requests)
+	}
+	fmt.Fprintf(
+		&b, "%s   elapsed %v   vus %d/%d   requests %d   errors %d (%.2f%%)\n\n",
+		tm.Bold(d.title),
+		now.Sub(d.started).Round(time.Second),
+		activeVUs,
+		virtualUsers,
+		d.requests,
+		d.failures,
+		errorRate,
+	)
+
+	// The sparklines take what the labels leave of the width
+	sparkWidth := DASHBOARD_HISTORY
+	if width > 0 && width-30 < sparkWidth {
+		sparkWidth = width - 30
+	}
+	p95 := time.Duration(d.p95[len(d.p95)-1])
+	fmt.Fprintf(&b, "Throughput  %s  %.2f/s\n", getSparkline(d.throughput, sparkWidth), rate)
+	fmt.Fprintf(&b, "p95         %s  %v\n\n", getSparkline(d.p95, sparkWidth), p95.Round(time.Millisecond))
+
+	table := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "#\tRequest\tRequests\tErrors\tRPS\tp50\tp95\tp99\n")
+	ids := make([]int, 0, len(d.rows))
+	for id := range d.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		row := d.rows[id]
+		fmt.Fprintf(
+			table, "%d.\t%s\t%d\t%d\t%.2f\t%v\t%v\t%v\n",
+			row.id,
+			row.name,
+			row.requests,
+			row.failures,
+			row.rate,
+			row.latencies.percentile(50).Round(time.Millisecond),
+			row.latencies.percentile(95).Round(time.Millisecond),
+			row.latencies.percentile(99).Round(time.Millisecond),
+		)
+	}
+	fmt.Fprintln(&b, table)
+
+	if len(d.errors) > 0 {
+		fmt.Fprintln(&b, "Last errors")
+		for _, message := range d.errors {
+			fmt.Fprintf(&b, "  %s\n", message)
+		}
+	}
+	return b.String()
+}
+
+// getSparkline draw the last values of a series as bars, at most width of
+// them, the highest as a full one
+func getSparkline(values []float64, width int) string {
+	if width < 0 {
+		width = 0
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	highest := 0.0
+	for _, value := range values {
+		if value > highest {
+			highest = value
+		}
+	}
+	line := make([]rune, 0, len(values))
+	for _, value := range values {
+		spark := 0
+		if highest > 0 {
+			spark = int(value / highest * float64(len(sparks)-1))
+		}
+		line = append(line, sparks[spark])
+	}
+	return string(line)
+}
+
+// showDashboard redraw the dashboard every second until done is closed, and
+// once more then
+func (a *Attack) showDashboard(dashboard *Dashboard, done <-chan struct{}) {
+	virtualUsers := a.getVirtualUsers()
+	draw := func() {
+		screen := dashboard.refresh(int(atomic.LoadInt32(&a.run.activeVUs)), virtualUsers, tm.Width())
+		tm.Clear()
+		tm.MoveCursor(1, 1)
+		tm.Print(screen)
+		tm.Flush()
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			draw()
+		case <-done:
+			draw()
+			return
+		}
+	}
+}
+
+// isTerminal check whether the standard output is a terminal of a known
+// size, rather than a file or a pipe such as in CI
+func isTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && tm.Height() > 0
+}
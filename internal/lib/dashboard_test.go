@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	cartridge := &Cartridge{id: 1, path: NewNamedFeature(GET_METHOD), successStatusCodes: []int{200}}
+	cartridge.path.rawDescription = "/items"
+	request, _ := http.NewRequest(GET_METHOD, "http://example.com/items", nil)
+	newHit := func(status int, err error) *Hit {
+		now := time.Now()
+		hit := &Hit{shot: &Shot{cartridge: cartridge, request: request}, err: err, startTime: now.Add(-20 * time.Millisecond), endTime: now}
+		if status > 0 {
+			hit.response = &http.Response{StatusCode: status, Status: http.StatusText(status)}
+		}
+		return hit
+	}
+
+	dashboard := NewDashboard(&Attack{target: &Target{Scheme: HTTP_SCHEME, Host: "example.com", Port: 80}})
+	for i := 0; i < 8; i++ {
+		dashboard.add(newHit(200, nil))
+	}
+	dashboard.add(newHit(503, nil))
+	dashboard.add(newHit(0, errors.New("connection refused")))
+
+	screen := dashboard.refresh(2, 4, 80)
+	for _, part := range []string{"example.com", "vus 2/4", "requests 10", "errors 2 (20.00%)", "GET /items", "20ms", "Service Unavailable", "connection refused", "█"} {
+		if !strings.Contains(screen, part) {
+			t.Errorf("expected %q on the dashboard:\n%s", part, screen)
+		}
+	}
+
+	// A quiet second draws a low bar after the full one
+	screen = dashboard.refresh(2, 4, 80)
+	if !strings.Contains(screen, "█▁") {
+		t.Errorf("expected the throughput to drop on the sparkline:\n%s", screen)
+	}
+	if line := getSparkline([]float64{1, 2, 3, 4}, 2); line != "▆█" {
+		t.Errorf("got sparkline %q, want the last two values", line)
+	}
+}
@@ -0,0 +1,243 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	EXTRACT_KIND_JSON   = "json"
+	EXTRACT_KIND_HEADER = "header"
+	EXTRACT_KIND_REGEX  = "regex"
+	EXTRACT_KIND_STATUS = "status"
+)
+
+var jsonPathIndexRegexp = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// Extractor a variable taken from a response, given in the extract map of a
+// request
+//
+//	extract:
+//	  ids: {json: items.*.id}
+//	  first: {json: "items[0].name"}
+//	  token: {header: X-Token}
+//	  csrf: {regex: 'name="csrf" value="([^"]+)"'}
+//
+// Json paths are dot separated keys and array indexes where * matches every
+// element, which makes the variable a list that FOREACH can iterate over. A
+// regex stores its first group, or the whole match if it has none. Variables
+// are used like params, as ${name}, and kept by the virtual user for the rest
+// of its script. A variable is removed when it is not found in a response.
+type Extractor struct {
+	name       string
+	kind       string
+	expression string
+	regexp     *regexp.Regexp
+}
+
+// NewExtractors create extractors from the raw extract map of a request
+func NewExtractors(rawExtractors map[interface{}]interface{}) ([]*Extractor, error) {
+	names := make([]string, 0, len(rawExtractors))
+	for rawName := range rawExtractors {
+		names = append(names, fmt.Sprintf("%v", rawName))
+	}
+	sort.Strings(names)
+
+	extractors := make([]*Extractor, 0, len(rawExtractors))
+	for _, name := range names {
+		rawMap, ok := rawExtractors[name].(map[interface{}]interface{})
+		if !ok || len(rawMap) != 1 {
+			return nil, fmt.Errorf("extract %s needs one of json, header, regex or status", name)
+		}
+		extractor := &Extractor{name: name}
+		for rawKind, rawExpression := range rawMap {
+			extractor.kind = fmt.Sprintf("%v", rawKind)
+			extractor.expression = fmt.Sprintf("%v", rawExpression)
+		}
+		switch extractor.kind {
+		case EXTRACT_KIND_JSON, EXTRACT_KIND_HEADER, EXTRACT_KIND_STATUS:
+		case EXTRACT_KIND_REGEX:
+			compiled, err := regexp.Compile(extractor.expression)
+			if err != nil {
+				return nil, fmt.Errorf("extract %s has an invalid regex: %v", name, err)
+			}
+			extractor.regexp = compiled
+		default:
+			return nil, fmt.Errorf("extract %s has an unknown kind %s", name, extractor.kind)
+		}
+		extractors = append(extractors, extractor)
+	}
+	return extractors, nil
+}
+
+// extract get the variable from a response, a string or a list of strings
+func (e *Extractor) extract(response *http.Response, body []byte, document *jsonDocument) (interface{}, bool) {
+	switch e.kind {
+	case EXTRACT_KIND_HEADER:
+		value := response.Header.Get(e.expression)
+		return value, len(value) > 0
+	case EXTRACT_KIND_STATUS:
+		return strconv.Itoa(response.StatusCode), true
+	case EXTRACT_KIND_REGEX:
+		matches := e.regexp.FindSubmatch(body)
+		if matches == nil {
+			return nil, false
+		}
+		if len(matches) > 1 {
+			return string(matches[1]), true
+		}
+		return string(matches[0]), true
+	case EXTRACT_KIND_JSON:
+		root, err := document.get(body)
+		if err != nil {
+			return nil, false
+		}
+		value, found := getJSONPath(root, e.expression)
+		if !found {
+			return nil, false
+		}
+		if list, ok := value.([]interface{}); ok {
+			values := make([]string, len(list))
+			for i, item := range list {
+				values[i] = getJSONString(item)
+			}
+			return values, true
+		}
+		return getJSONString(value), true
+	}
+	return nil, false
+}
+
+// jsonDocument a response body parsed once however many extractors use it
+type jsonDocument struct {
+	parsed bool
+	root   interface{}
+	err    error
+}
+
+func (d *jsonDocument) get(body []byte) (interface{}, error) {
+	if !d.parsed {
+		d.parsed = true
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		d.err = decoder.Decode(&d.root)
+	}
+	return d.root, d.err
+}
+
+// getJSONPath walk a parsed json document. A path with a * gives a list of
+// every match.
+func getJSONPath(root interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = jsonPathIndexRegexp.ReplaceAllString(path, ".$1")
+	results := []interface{}{root}
+	wildcard := false
+	for _, segment := range strings.Split(path, ".") {
+		if len(segment) == 0 {
+			continue
+		}
+		next := make([]interface{}, 0, len(results))
+		for _, result := range results {
+			switch value := result.(type) {
+			case map[string]interface{}:
+				if segment == "*" {
+					wildcard = true
+					keys := make([]string, 0, len(value))
+					for key := range value {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, value[key])
+					}
+				} else if child, ok := value[segment]; ok {
+					next = append(next, child)
+				}
+			case []interface{}:
+				if segment == "*" {
+					wildcard = true
+					next = append(next, value...)
+				} else if index, err := strconv.Atoi(segment); err == nil {
+					if index < 0 {
+						index += len(value)
+					}
+					if index >= 0 && index < len(value) {
+						next = append(next, value[index])
+					}
+				}
+			}
+		}
+		results = next
+	}
+	if wildcard {
+		return results, true
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	return results[0], true
+}
+
+// getJSONString get a json value as a variable, strings as they are and other
+// values as json
+func getJSONString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// extract store the variables a request extracts from its response
+func (k *Killer) extract(cartridge *Cartridge, response *http.Response, body []byte) {
+	document := new(jsonDocument)
+	for _, extractor := range cartridge.extractors {
+		if value, ok := extractor.extract(response, body, document); ok {
+			k.setVar(extractor.name, value)
+			k.run.log("extract - %v: %v", extractor.name, value)
+		} else {
+			delete(k.vars, extractor.name)
+			k.run.log("extract - %v not found", extractor.name)
+		}
+	}
+}
+
+func (k *Killer) setVar(name string, value interface{}) {
+	if k.vars == nil {
+		k.vars = make(map[string]interface{})
+	}
+	k.vars[name] = value
+}
+
+// getVar get a variable as a string, lists being comma separated
+func (k *Killer) getVar(name string) (string, bool) {
+	switch value := k.vars[name].(type) {
+	case string:
+		return value, true
+	case []string:
+		return strings.Join(value, ","), true
+	}
+	return "", false
+}
+
+// getList get a variable as a list
+func (k *Killer) getList(name string) []string {
+	switch value := k.vars[name].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	}
+	return []string{}
+}
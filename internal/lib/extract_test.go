@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestExtract(t *testing.T) {
+	var cartridges Cartridges
+	err := yaml.Unmarshal([]byte(`
+- GET: /list
+  extract:
+    ids: {json: "$.items[*].id"}
+    last: {json: "items[-1].name"}
+    meta: {json: meta}
+    token: {header: X-Token}
+    csrf: {regex: 'csrf=(\w+)'}
+    missing: {json: items.0.nope}
+`), &cartridges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := &http.Response{StatusCode: 200, Header: http.Header{"X-Token": {"abc"}}}
+	body := []byte(`{"items":[{"id":1,"name":"a"},{"id":2,"name":"b"}],"meta":{"page":1},"html":"csrf=xyz"}`)
+	killer := new(Killer)
+	killer.setVar("missing", "stale")
+	killer.extract(cartridges[0], response, body)
+
+	if ids := killer.getList("ids"); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("got ids %v", ids)
+	}
+	expected := map[string]string{"last": "b", "meta": `{"page":1}`, "token": "abc", "csrf": "xyz"}
+	for name, want := range expected {
+		if value, _ := killer.getVar(name); value != want {
+			t.Errorf("got %s %q, want %q", name, value, want)
+		}
+	}
+	if _, ok := killer.getVar("missing"); ok {
+		t.Error("expected a variable not found in the response to be removed")
+	}
+}
+
+func TestCondition(t *testing.T) {
+	killer := new(Killer)
+	killer.lastStatus = 200
+	killer.setVar("role", "admin")
+
+	checks := map[string]bool{
+		`{var: role}`:                         true,
+		`{var: nobody}`:                       false,
+		`{var: nobody, exists: false}`:        true,
+		`{var: role, equals: admin}`:          true,
+		`{var: role, not_equals: admin}`:      false,
+		`{var: role, matches: "^ad"}`:         true,
+		`{status: [201, 200]}`:                true,
+		`{status: 404, var: role}`:            false,
+		`{status: 200, var: role, equals: x}`: false,
+	}
+	for rawCondition, want := range checks {
+		var raw interface{}
+		if err := yaml.Unmarshal([]byte(rawCondition), &raw); err != nil {
+			t.Fatal(err)
+		}
+		condition, err := NewCondition(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", rawCondition, err)
+		}
+		if got := condition.check(killer); got != want {
+			t.Errorf("%s: got %v, want %v", rawCondition, got, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cheggaaa/pb"
+)
+
+const (
+	FLOW_DEFAULT_MAX = 100
+	FLOW_DEFAULT_AS  = "item"
+)
+
+// Flow the control of a REPEAT, IF or FOREACH block, whose requests are
+// given in do (and else for IF)
+//
+//	requests:
+//	  - REPEAT: {times: 3}
+//	    do:
+//	      - GET: /poll
+//	  - REPEAT: {while: {var: next, exists: true}, max: 20}
+//	    do:
+//	      - GET: /items?cursor=${next}
+//	        extract:
+//	          next: {json: next_cursor}
+//	  - IF: {status: 200, var: role, equals: admin}
+//	    do:
+//	      - GET: /admin
+//	    else:
+//	      - GET: /home
+//	  - FOREACH: {var: ids, as: id}
+//	    do:
+//	      - GET: /items/${id}
+//
+// A while loop stops after max iterations, 100 by default, so that a
+// response that never changes cannot hang the run.
+type Flow struct {
+	times     int
+	while     *Condition
+	max       int
+	condition *Condition
+	list      string
+	as        string
+}
+
+// NewFlow create the control of a block from its raw value
+func NewFlow(kind string, rawValue interface{}) (*Flow, error) {
+	flow := &Flow{max: FLOW_DEFAULT_MAX, as: FLOW_DEFAULT_AS}
+	switch kind {
+	case REPEAT_METHOD:
+		if times, ok := rawValue.(int); ok {
+			flow.times = times
+			break
+		}
+		rawFlow, ok := rawValue.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("REPEAT needs a number of times or a map")
+		}
+		if rawTimes, ok := rawFlow["times"]; ok {
+			times, ok := rawTimes.(int)
+			if !ok || times < 0 {
+				return nil, fmt.Errorf("REPEAT times must be a positive number")
+			}
+			flow.times = times
+		}
+		if rawMax, ok := rawFlow["max"]; ok {
+			max, ok := rawMax.(int)
+			if !ok || max < 0 {
+				return nil, fmt.Errorf("REPEAT max must be a positive number")
+			}
+			flow.max = max
+		}
+		if rawWhile, ok := rawFlow["while"]; ok {
+			if _, ok := rawFlow["times"]; ok {
+				return nil, fmt.Errorf("REPEAT takes times or while, not both")
+			}
+			condition, err := NewCondition(rawWhile)
+			if err != nil {
+				return nil, err
+			}
+			flow.while = condition
+		} else if _, ok := rawFlow["times"]; !ok {
+			return nil, fmt.Errorf("REPEAT needs times or while")
+		}
+	case IF_METHOD:
+		condition, err := NewCondition(rawValue)
+		if err != nil {
+			return nil, err
+		}
+		flow.condition = condition
+	case FOREACH_METHOD:
+		switch value := rawValue.(type) {
+		case string:
+			flow.list = value
+		case map[interface{}]interface{}:
+			flow.list = fmt.Sprintf("%v", value["var"])
+			if as, ok := value["as"]; ok {
+				flow.as = fmt.Sprintf("%v", as)
+			}
+		}
+		if len(flow.list) == 0 || flow.list == "<nil>" {
+			return nil, fmt.Errorf("FOREACH needs a var to iterate over")
+		}
+	}
+	return flow, nil
+}
+
+// getExpectedIterations get how many times a block is expected to run its
+// requests, once for blocks whose count depends on responses
+func (f *Flow) getExpectedIterations() int {
+	if f.while == nil && f.condition == nil && len(f.list) == 0 {
+		return f.times
+	}
+	return 1
+}
+
+// Condition a test of a variable or of the status of the last response. All
+// of the given checks must pass.
+//
+//	var: name        variable to test, on its own it must exist
+//	exists: false    the variable must not be set
+//	equals: value
+//	not_equals: value
+//	matches: regex
+//	status: 200      or a list, the status of the last response
+type Condition struct {
+	variable  string
+	exists    *bool
+	equals    *string
+	notEquals *string
+	matches   *regexp.Regexp
+	status    []int
+}
+
+// NewCondition create a condition from its raw map
+func NewCondition(rawValue interface{}) (*Condition, error) {
+	rawCondition, ok := rawValue.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("condition must be a map")
+	}
+	condition := new(Condition)
+	for rawKey, rawValue := range rawCondition {
+		value := fmt.Sprintf("%v", rawValue)
+		switch rawKey {
+		case "var":
+			condition.variable = value
+		case "exists":
+			exists, ok := rawValue.(bool)
+			if !ok {
+				return nil, fmt.Errorf("condition exists must be true or false")
+			}
+			condition.exists = &exists
+		case "equals":
+			condition.equals = &value
+		case "not_equals":
+			condition.notEquals = &value
+		case "matches":
+			matches, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("condition matches is not a valid regex: %v", err)
+			}
+			condition.matches = matches
+		case "status":
+			condition.status = new(Cartridges).getCodes(rawValue)
+		default:
+			return nil, fmt.Errorf("unknown condition %v", rawKey)
+		}
+	}
+	hasValueCheck := condition.exists != nil || condition.equals != nil || condition.notEquals != nil || condition.matches != nil
+	if len(condition.variable) == 0 && hasValueCheck {
+		return nil, fmt.Errorf("condition needs a var to test")
+	}
+	if len(condition.variable) == 0 && len(condition.status) == 0 {
+		return nil, fmt.Errorf("condition needs a var or a status")
+	}
+	if len(condition.variable) > 0 && !hasValueCheck {
+		exists := true
+		condition.exists = &exists
+	}
+	return condition, nil
+}
+
+// check test the condition against the variables of a killer
+func (c *Condition) check(k *Killer) bool {
+	if len(c.status) > 0 {
+		found := false
+		for _, status := range c.status {
+			if status == k.lastStatus {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(c.variable) == 0 {
+		return true
+	}
+	value, ok := k.getVar(c.variable)
+	if c.exists != nil && ok != *c.exists {
+		return false
+	}
+	if c.equals != nil && (!ok || value != *c.equals) {
+		return false
+	}
+	if c.notEquals != nil && ok && value == *c.notEquals {
+		return false
+	}
+	if c.matches != nil && (!ok || !c.matches.MatchString(value)) {
+		return false
+	}
+	return true
+}
+
+// chargeFlow run the requests of a REPEAT, IF or FOREACH block
+func (k *Killer) chargeFlow(hits chan<- *Hit, bar *pb.ProgressBar, cartridge *Cartridge) {
+	flow := cartridge.flow
+	switch cartridge.getMethod() {
+	case REPEAT_METHOD:
+		if flow.while == nil {
+			for i := 0; i < flow.times; i++ {
+				k.chargeCartidges(hits, bar, cartridge.children)
+			}
+			return
+		}
+		for i := 0; i < flow.max && flow.while.check(k); i++ {
+			k.chargeCartidges(hits, bar, cartridge.children)
+		}
+	case IF_METHOD:
+		if flow.condition.check(k) {
+			k.chargeCartidges(hits, bar, cartridge.children)
+		} else {
+			k.chargeCartidges(hits, bar, cartridge.elseChildren)
+		}
+	case FOREACH_METHOD:
+		// The list is copied as the requests may extract it again
+		items := append([]string{}, k.getList(flow.list)...)
+		k.run.log("foreach - %v: %v", flow.list, items)
+		for _, item := range items {
+			k.setVar(flow.as, item)
+			k.chargeCartidges(hits, bar, cartridge.children)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// HISTOGRAM_PRECISION bits of a duration kept exactly, so that percentiles are
+// off by less than 1% whatever the number of requests
+const HISTOGRAM_PRECISION = 7
+
+// Histogram response times counted in buckets of microseconds, which take
+// the same memory for ten requests or ten million
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram create an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, 0)}
+}
+
+// record count a response time
+func (h *Histogram) record(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+	i := getBucket(uint64(duration / time.Microsecond))
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.total == 0 || duration < h.min {
+		h.min = duration
+	}
+	if duration > h.max {
+		h.max = duration
+	}
+	h.total++
+	h.sum += duration
+}
+
+// count get the number of response times counted
+func (h *Histogram) count() int64 {
+	return h.total
+}
+
+// mean get the average response time
+func (h *Histogram) mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// percentile get the response time that a percentage of the requests took
+// at most, to within the width of its bucket
+func (h *Histogram) percentile(percentile float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(float64(h.total) * percentile / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			low, width := getBucketRange(i)
+			duration := time.Duration(low+width/2) * time.Microsecond
+			// The extremes are known exactly
+			if duration < h.min {
+				duration = h.min
+			}
+			if duration > h.max {
+				duration = h.max
+			}
+			return duration
+		}
+	}
+	return h.max
+}
+
+// reset empty a histogram, keeping its buckets
+func (h *Histogram) reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.total, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// getBucket get the bucket of a value. Values below 2^HISTOGRAM_PRECISION
+// have a bucket each, larger ones share buckets whose width doubles with
+// every power of two.
+func getBucket(value uint64) int {
+	exact := uint64(1) << HISTOGRAM_PRECISION
+	if value < exact {
+		return int(value)
+	}
+	shift := bits.Len64(value) - HISTOGRAM_PRECISION
+	mantissa := value >> uint(shift)
+	return int(exact) + (shift-1)*int(exact/2) + int(mantissa-exact/2)
+}
+
+// getBucketRange get the lowest value of a bucket and its width
+func getBucketRange(bucket int) (uint64, uint64) {
+	exact := 1 << HISTOGRAM_PRECISION
+	if bucket < exact {
+		return uint64(bucket), 1
+	}
+	shift := (bucket-exact)/(exact/2) + 1
+	mantissa := uint64((bucket-exact)%(exact/2) + exact/2)
+	return mantissa << uint(shift), uint64(1) << uint(shift)
+}
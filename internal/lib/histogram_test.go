@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	for _, value := range []uint64{0, 1, 127, 128, 129, 1000, 65535, 1 << 40} {
+		low, width := getBucketRange(getBucket(value))
+		if value < low || value >= low+width {
+			t.Errorf("%d: got bucket [%d, %d)", value, low, low+width)
+		}
+	}
+
+	histogram := NewHistogram()
+	if histogram.percentile(50) != 0 || histogram.mean() != 0 {
+		t.Errorf("expected an empty histogram to report zeros")
+	}
+	for i := 1; i <= 10000; i++ {
+		histogram.record(time.Duration(i) * time.Millisecond)
+	}
+	for _, percentile := range []float64{50, 95, 99} {
+		want := time.Duration(percentile*100) * time.Millisecond
+		got := histogram.percentile(percentile)
+		if math.Abs(float64(got-want)) > float64(want)/100 {
+			t.Errorf("p%v: got %v, want %v to within 1%%", percentile, got, want)
+		}
+	}
+	if histogram.min != time.Millisecond || histogram.max != 10*time.Second || histogram.percentile(100) != 10*time.Second {
+		t.Errorf("got min %v and max %v, want them exact", histogram.min, histogram.max)
+	}
+	if histogram.count() != 10000 || histogram.mean() != 5000500*time.Microsecond {
+		t.Errorf("got %d durations with a mean of %v", histogram.count(), histogram.mean())
+	}
+	buckets := len(histogram.counts)
+	histogram.record(time.Millisecond)
+	if len(histogram.counts) != buckets {
+		t.Errorf("expected no bucket to be added for a known duration")
+	}
+
+	histogram.reset()
+	histogram.record(42 * time.Millisecond)
+	if histogram.count() != 1 || histogram.percentile(50) != 42*time.Millisecond {
+		t.Errorf("expected a reset histogram to start over, got p50 %v", histogram.percentile(50))
+	}
+}
+
+func TestRateCounter(t *testing.T) {
+	rates := newRateCounter()
+	for second := int64(100); second < 200; second++ {
+		for i := int64(0); i < second%3+1; i++ {
+			rates.add(second)
+		}
+	}
+	if len(rates.seconds) > RATE_WINDOW {
+		t.Errorf("got %d seconds kept apart, want at most %d", len(rates.seconds), RATE_WINDOW)
+	}
+	min, avg, max := rates.get()
+	if min != 1 || max != 3 || math.Abs(avg-2) > 0.02 {
+		t.Errorf("got %d / %.2f / %d requests per second, want 1 / 2 / 3", min, avg, max)
+	}
+}
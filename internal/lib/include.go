@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// getConfigFiles get the configuration files the top level requests are read
+// from, none when the configuration was not given as a file
+func (r *Run) getConfigFiles() []string {
+	if len(r.configFile) == 0 {
+		return []string{}
+	}
+	return []string{r.configFile}
+}
+
+// resolvePath resolve a path relative to the directory of the innermost of
+// the configuration files being read, or the working directory if there is
+// none
+func resolvePath(files []string, path string) string {
+	if filepath.IsAbs(path) || len(files) == 0 {
+		return path
+	}
+	return filepath.Join(filepath.Dir(files[len(files)-1]), path)
+}
+
+// prepareCartridges read the files that requests name, included requests,
+// bodies and uploads, and give the requests their ids. files are the absolute
+// paths of the configuration files the cartridges were read from, the last
+// one being the innermost include.
+func (r *Run) prepareCartridges(cartridges Cartridges, files []string) error {
+	for _, cartridge := range cartridges {
+		if cartridge.prepared {
+			continue
+		}
+		cartridge.prepared = true
+		if cartridge.include != nil {
+			if err := r.include(cartridge, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if cartridge.body != nil {
+			if err := cartridge.body.prepare(files); err != nil {
+				return err
+			}
+		}
+		for _, file := range cartridge.files {
+			file.path = resolvePath(files, file.path)
+			if err := file.prepare(); err != nil {
+				return err
+			}
+		}
+		if !cartridge.isGroup() && cartridge.id == 0 {
+			cartridge.id = r.nextID()
+		}
+		if err := r.prepareCartridges(cartridge.children, files); err != nil {
+			return err
+		}
+		if err := r.prepareCartridges(cartridge.elseChildren, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include read a file of reusable requests for an INCLUDE entry. The value is
+// a path or a map with a file and whether to also take the file's params and
+// headers
+//
+//	requests:
+//	  - INCLUDE: login.yaml
+//	  - INCLUDE:
+//	      file: login.yaml
+//	      params: true
+//	      headers: true
+//
+// The file holds either a list of requests or a map with requests and
+// optionally params and headers, like a configuration file. Its headers are
+// added to the included requests only, its params are added to the global
+// params unless a param of the same name exists.
+func (r *Run) include(c *Cartridge, files []string) error {
+	var file string
+	var withParams, withHeaders bool
+	switch c.include.(type) {
+	case string:
+		file = c.include.(string)
+	case map[interface{}]interface{}:
+		rawMap := c.include.(map[interface{}]interface{})
+		file, _ = rawMap["file"].(string)
+		withParams, _ = rawMap["params"].(bool)
+		withHeaders, _ = rawMap["headers"].(bool)
+	}
+	if len(file) == 0 {
+		return fmt.Errorf("INCLUDE needs a file")
+	}
+
+	path := resolvePath(files, file)
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	for _, includedPath := range files {
+		if includedPath == path {
+			return fmt.Errorf("INCLUDE of %s is circular", file)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read included file: %v", err)
+	}
+	r.log("include - %v", path)
+
+	var rawRequests []interface{}
+	var rawFile interface{}
+	if err := yaml.Unmarshal(data, &rawFile); err != nil {
+		return fmt.Errorf("could not parse included file %s: %v", file, err)
+	}
+	switch rawFile.(type) {
+	case []interface{}:
+		rawRequests = rawFile.([]interface{})
+	case map[interface{}]interface{}:
+		rawMap := rawFile.(map[interface{}]interface{})
+		rawRequests, _ = rawMap["requests"].([]interface{})
+		if rawParams, ok := rawMap["params"].(map[interface{}]interface{}); ok && withParams {
+			c.includedCalibers = make(CaliberMap)
+			c.includedCalibers.fill(rawParams)
+		}
+		if rawHeaders, ok := rawMap["headers"].(map[interface{}]interface{}); ok && withHeaders {
+			c.bulletFeatures = make(Features, 0)
+			c.bulletFeatures.fill(rawHeaders)
+		}
+	default:
+		return fmt.Errorf("included file %s has no requests", file)
+	}
+
+	c.children = make(Cartridges, 0)
+	if err := c.children.fill(rawRequests); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	// Paths in the included file are relative to it
+	includedFiles := append(append(make([]string, 0, len(files)+1), files...), path)
+	if err := r.prepareCartridges(c.children, includedFiles); err != nil {
+		return err
+	}
+	if len(c.bulletFeatures) > 0 {
+		c.children.addFeatures(c.bulletFeatures)
+	}
+	return nil
+}
+
+// addFeatures add headers to every request, before the request's own headers
+// so that those win
+func (c Cartridges) addFeatures(features Features) {
+	for _, cartridge := range c {
+		if cartridge.isGroup() {
+			cartridge.children.addFeatures(features)
+			cartridge.elseChildren.addFeatures(features)
+			continue
+		}
+		bulletFeatures := make(Features, 0, len(features)+len(cartridge.bulletFeatures))
+		bulletFeatures = append(bulletFeatures, features...)
+		cartridge.bulletFeatures = append(bulletFeatures, cartridge.bulletFeatures...)
+	}
+}
+
+// addIncludedCalibers add params of included files that are not already set
+func (cc *CallCollection) addIncludedCalibers(cartridges Cartridges) {
+	for _, cartridge := range cartridges {
+		for key, caliber := range cartridge.includedCalibers {
+			if _, ok := cc.Calibers[key]; !ok {
+				cc.Calibers[key] = caliber
+			}
+		}
+		cc.addIncludedCalibers(cartridge.children)
+		cc.addIncludedCalibers(cartridge.elseChildren)
+	}
+}
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newIncludeRun write files to a temporary directory and create a run from
+// the one named main.yaml
+func newIncludeRun(t *testing.T, files map[string]string) (*Run, error) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "main.yaml")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRun(data, path)
+}
+
+func TestInclude(t *testing.T) {
+	run, err := newIncludeRun(t, map[string]string{
+		"main.yaml": `
+host: localhost
+params:
+  user: main
+requests:
+  - GET: /first
+  - INCLUDE:
+      file: fragments/login.yaml
+      params: true
+      headers: true
+  - INCLUDE: fragments/logout.yaml
+  - GET: /last
+`,
+		"fragments/login.yaml": `
+params:
+  user: included
+  token: abc
+headers:
+  X-Included: fragment
+requests:
+  - INCLUDE: nested/csrf.yaml
+  - POST: /login
+    headers:
+      X-Own: own
+`,
+		"fragments/nested/csrf.yaml": `
+- GET: /csrf
+`,
+		"fragments/logout.yaml": `
+headers:
+  X-Logout: fragment
+requests:
+  - GET: /logout
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cartridges := run.collection.Cartridges.toPlainSlice()
+	paths := make([]string, 0, len(cartridges))
+	for _, cartridge := range cartridges {
+		paths = append(paths, cartridge.path.rawDescription.(string))
+	}
+	if got := strings.Join(paths, " "); got != "/first /csrf /login /logout /last" {
+		t.Errorf("got requests %s, want the included ones in place", got)
+	}
+
+	// Headers of an included file go before the request's own, and only with
+	// headers: true
+	headers := func(cartridge *Cartridge) string {
+		names := make([]string, 0)
+		for _, feature := range cartridge.bulletFeatures {
+			names = append(names, feature.name)
+		}
+		return strings.Join(names, " ")
+	}
+	if got := headers(cartridges[1]); got != "X-Included" {
+		t.Errorf("got nested headers %s, want X-Included", got)
+	}
+	if got := headers(cartridges[2]); got != "X-Included X-Own" {
+		t.Errorf("got login headers %s, want X-Included X-Own", got)
+	}
+	if got := headers(cartridges[3]); len(got) > 0 {
+		t.Errorf("got logout headers %s, want none without headers: true", got)
+	}
+
+	// Params of an included file are added unless set already
+	calibers := run.collection.Calibers
+	if calibers["token"] == nil || calibers["token"].feature.description != "abc" {
+		t.Error("expected the included token param")
+	}
+	if calibers["user"].feature.description != "main" {
+		t.Errorf("got user %v, want the param of the including file", calibers["user"].feature.description)
+	}
+}
+
+func TestIncludeCircular(t *testing.T) {
+	_, err := newIncludeRun(t, map[string]string{
+		"main.yaml": `
+host: localhost
+requests:
+  - INCLUDE: fragments/a.yaml
+`,
+		"fragments/a.yaml": `
+- GET: /a
+- INCLUDE: b.yaml
+`,
+		"fragments/b.yaml": `
+- INCLUDE: a.yaml
+`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("got error %v, want a circular include", err)
+	}
+}
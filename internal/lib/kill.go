@@ -0,0 +1,817 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httputil"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"math/rand"
+
+	"github.com/cheggaaa/pb"
+	"go.uber.org/ratelimit"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// DEFAULT_TIMEOUT seconds a request may take when no timeout is given
+	DEFAULT_TIMEOUT = 2
+	// STOP_GRACE how long requests in flight may take to finish once a run is
+	// stopped, before they are cancelled
+	STOP_GRACE = 5 * time.Second
+	// HITS_BUFFER hits that may wait to be reported
+	HITS_BUFFER = 1024
+)
+
+// Attack a collection of properties for a set of hits
+type Attack struct {
+	run                 *Run
+	CallCollectionCount int           `yaml:"concurrency"`
+	AttemptsCount       int           `yaml:"loopcount"`
+	Timeout             time.Duration `yaml:"timeout"`
+	Rate                int           `yaml:"ratepersecond"`
+	RandomDelayMs       int           `yaml:"randomdelayms"`
+	callCollection      *CallCollection
+	scenarios           []*Scenario
+	target              *Target
+}
+
+// SetGun set target for a call
+func (a *Attack) SetGun(callCollection *CallCollection) {
+	a.callCollection = callCollection
+}
+
+// SetTarget set target for hits
+func (a *Attack) SetTarget(target *Target) {
+	a.target = target
+}
+
+// Prepare get ready to hit targets. The attack must be part of a run, as
+// created by NewRun.
+func (a *Attack) Prepare() error {
+	if a.run == nil {
+		return fmt.Errorf("attack has no run, create it with NewRun")
+	}
+	a.run.ln()
+	a.run.log("prepare kill")
+
+	err := a.target.prepare()
+	a.run.log("target - %v://%v:%v%v", a.target.Scheme, a.target.Host, a.target.Port, a.target.basePath)
+	if collectionErr := a.callCollection.prepare(); err == nil {
+		err = collectionErr
+	}
+	if sinksErr := a.run.reporter.prepareSinks(); err == nil {
+		err = sinksErr
+	}
+
+	if a.CallCollectionCount == 0 {
+		a.CallCollectionCount = 1
+	}
+	a.run.log("callcollection count - %v", a.CallCollectionCount)
+	a.scenarios = a.callCollection.getScenarios()
+	if shareErr := shareVirtualUsers(a.scenarios, a.CallCollectionCount); err == nil {
+		err = shareErr
+	}
+	for _, scenario := range a.scenarios {
+		a.run.log("scenario %v - %v virtual users", scenario.name, scenario.vus)
+	}
+
+	if a.AttemptsCount == 0 {
+		a.AttemptsCount = 1
+	}
+	a.run.log("attempts count - %v", a.AttemptsCount)
+
+	if a.Timeout == 0 {
+		a.Timeout = DEFAULT_TIMEOUT
+	}
+	if a.Rate == 0 {
+		a.Rate = 1000
+	}
+
+	a.run.log("timeout - %v", a.Timeout)
+	a.run.log("shots count - %v", a.run.shotsCount)
+
+	return err
+}
+
+// Start begin a set of hits. When the context is done, such as on Ctrl-C, no
+// more requests are sent and the hits completed until then are reported as
+// interrupted.
+func (a *Attack) Start(ctx context.Context) {
+	a.setRateLimit()
+
+	a.run.ln()
+	a.run.log("start kill")
+
+	stats := NewStats()
+	a.run.setStats(stats)
+	observers := []observer{stats}
+	if a.run.metrics != nil {
+		observers = append(observers, a.run.metrics)
+		defer a.run.closeMetrics(ctx)
+	}
+	if pusher := a.run.startPush(); pusher != nil {
+		observers = append(observers, pusher)
+		defer pusher.stop()
+	}
+	// The dashboard or lines of statistics take the place of the progress
+	// bar. Without a terminal, such as in CI, the dashboard falls back to a
+	// line every second.
+	interval := time.Duration(a.run.reporter.StatsInterval * float64(time.Second))
+	var dashboard *Dashboard
+	if a.run.reporter.Dashboard {
+		if isTerminal() {
+			dashboard = NewDashboard(a)
+			observers = append(observers, dashboard)
+		} else if interval == 0 {
+			interval = time.Second
+		}
+	}
+	done := make(chan struct{})
+	live := new(sync.WaitGroup)
+	if dashboard != nil || interval > 0 {
+		live.Add(1)
+		go func() {
+			defer live.Done()
+			if dashboard != nil {
+				a.showDashboard(dashboard, done)
+			} else {
+				a.printLines(stats, interval, done)
+			}
+		}()
+	}
+
+	// аггрегируем результаты задания и выводим статистику в консоль.
+	a.launch(ctx, a.AttemptsCount, dashboard == nil && interval == 0, func(hits <-chan *Hit) {
+		for hit := range hits {
+			for _, observer := range observers {
+				observer.add(hit)
+			}
+		}
+		close(done)
+		live.Wait()
+		a.run.reporter.report(ctx, a, stats)
+	})
+}
+
+// getVirtualUsers get the number of virtual users of all scenarios
+func (a *Attack) getVirtualUsers() int {
+	virtualUsers := 0
+	for _, scenario := range a.scenarios {
+		virtualUsers += scenario.vus
+	}
+	return virtualUsers
+}
+
+// setRateLimit limit the requests of the attack to its rate per second, 1000
+// meaning no limit
+func (a *Attack) setRateLimit() {
+	a.run.limiter = ratelimit.New(a.Rate, ratelimit.WithoutSlack)
+	if a.Rate == 1000 {
+		a.run.limiter = ratelimit.NewUnlimited()
+	}
+}
+
+// launch the phases and the virtual users of an attack, handing the hits to
+// consume as they arrive. Virtual users run their script the given number of
+// times, or when it is 0 until the context is done, which also stops them
+// between two requests. Requests in flight then get STOP_GRACE to finish.
+func (a *Attack) launch(ctx context.Context, iterations int, progress bool, consume func(hits <-chan *Hit)) {
+	// отдаем рутинам все ядра процессора
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	// считаем кол-во результатов.
+	// RANDOM groups may sample requests, so this is an estimate.
+	virtualUsers, shotsCount := 0, 0.0
+	for _, scenario := range a.scenarios {
+		virtualUsers += scenario.vus
+		shotsCount += float64(scenario.vus) * scenario.callCollection.Cartridges.getExpectedCount()
+		scenario.limiter = a.run.limiter
+		if scenario.Rate > 0 {
+			scenario.limiter = ratelimit.New(scenario.Rate, ratelimit.WithoutSlack)
+		}
+	}
+	hitsCount := iterations * int(math.Ceil(shotsCount))
+	a.run.log("expected hits count: %v", hitsCount)
+
+	group := new(sync.WaitGroup)
+	// создаем канал результатов
+	// Hits are aggregated as they arrive, so the channel only absorbs bursts
+	// and memory does not grow with the length of the run
+	hits := make(chan *Hit, HITS_BUFFER+virtualUsers)
+	// Results are consumed as they arrive, since requests made on the side
+	// such as token fetches are not known in advance.
+	reported := make(chan struct{})
+	go func() {
+		consume(hits)
+		close(reported)
+	}()
+	requests, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	go func() {
+		select {
+		case <-ctx.Done():
+			timer := time.NewTimer(STOP_GRACE)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				cancelRequests()
+			case <-requests.Done():
+			}
+		case <-requests.Done():
+		}
+	}()
+
+	// Setup runs once before the load, and what it extracts, such as an admin
+	// token, is shared with every virtual user
+	phaseKiller := a.newPhaseKiller(ctx, requests)
+	phaseKiller.runPhase(hits, PHASE_SETUP)
+
+	// Killers live for the whole run, so that a virtual user keeps its
+	// session, cookies, variables and connections from one repetition to the
+	// next
+	killers := make([]*Killer, 0, virtualUsers)
+	for _, scenario := range a.scenarios {
+		for j := 0; j < scenario.vus; j++ {
+			killer := new(Killer)
+			killer.run = a.run
+			killer.setTarget(a.target)
+			killer.setGun(scenario.callCollection)
+			killer.scenario = scenario
+			killer.requests = requests
+			killer.shareVars(phaseKiller)
+			killer.prepare()
+			killers = append(killers, killer)
+		}
+	}
+
+	// создаем програсс бар
+	var bar *pb.ProgressBar
+	if progress {
+		bar = pb.StartNew(hitsCount)
+	}
+	// запускаем конкуретные задания,
+	// если в настройках не указано кол-во заданий,
+	// тогда программа сделает одно задание.
+	// Each killer runs the script of its scenario loopcount times in order, as
+	// a user would, without waiting for the others between repetitions.
+	group.Add(len(killers))
+	for j, killer := range killers {
+		a.run.log("killer - %v %v charge", killer.scenario.name, j)
+		go killer.charge(ctx, hits, group, bar, iterations)
+	}
+	group.Wait()
+	cancelRequests()
+
+	// Teardown runs even when the load was stopped early, so it is no longer
+	// bound to the context of the run
+	phaseKiller.ctx = nil
+	phaseKiller.requests = nil
+	phaseKiller.runPhase(hits, PHASE_TEARDOWN)
+
+	close(hits)
+	// wait for the report of the results
+	<-reported
+}
+
+// Shot definition of properties required for a call to a target
+type Shot struct {
+	cartridge *Cartridge
+	request   *http.Request
+	client    *http.Client
+	timeout   time.Duration
+	killer    *Killer
+	auth      *Auth
+	signing   *Signing
+}
+
+// Killer definition of
+type Killer struct {
+	run            *Run
+	target         *Target
+	callCollection *CallCollection
+	scenario       *Scenario
+	session        *Caliber
+	client         *http.Client
+	rand           *rand.Rand
+	ctx            context.Context
+	// cancelled once the grace period after the killer was stopped is over
+	requests     context.Context
+	vars         map[string]interface{}
+	lastStatus   int
+	backoffUntil time.Time
+	backoffCount int
+	tokens       oauth2Tokens
+}
+
+func (k *Killer) setTarget(target *Target) {
+	k.target = target
+}
+
+func (k *Killer) setGun(callCollection *CallCollection) {
+	k.callCollection = callCollection
+}
+
+// getCallCollection get the collection of the killer's scenario, or an empty
+// one for a killer that was not given one
+func (k *Killer) getCallCollection() *CallCollection {
+	if k == nil || k.callCollection == nil {
+		return new(CallCollection)
+	}
+	return k.callCollection
+}
+
+// getTimeout get how long a request of the killer may take, unless it has a
+// timeout of its own
+func (k *Killer) getTimeout() time.Duration {
+	if k.run == nil {
+		return time.Second * DEFAULT_TIMEOUT
+	}
+	return time.Second * k.run.attack.Timeout
+}
+
+// prepare create the client of a killer, with its own cookies and
+// connections that are kept alive between requests
+func (k *Killer) prepare() {
+	options := cookiejar.Options{
+		PublicSuffixList: publicsuffix.List,
+	}
+	jar, err := cookiejar.New(&options)
+	if err != nil {
+		k.run.log("cookie wasn't created - %v", err)
+	}
+	k.client = new(http.Client)
+	k.client.Jar = jar
+	// Every killer draws its delays from its own source, seeded once
+	k.rand = rand.New(rand.NewSource(time.Now().UnixNano() ^ rand.Int63()))
+	k.client.Transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   k.getTimeout(),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: k.getTimeout(),
+	}
+}
+
+// charge run the vu_setup of a killer and then its script the given number
+// of times, or until the context is done when it is 0. Requests are built
+// just before they are sent, so they can use variables extracted from
+// earlier responses.
+func (k *Killer) charge(ctx context.Context, hits chan<- *Hit, group *sync.WaitGroup, bar *pb.ProgressBar, iterations int) {
+	defer group.Done()
+	defer k.client.CloseIdleConnections()
+
+	k.ctx = ctx
+	k.runPhase(hits, PHASE_VU_SETUP)
+	atomic.AddInt32(&k.run.activeVUs, 1)
+	defer atomic.AddInt32(&k.run.activeVUs, -1)
+	for i := 0; (iterations == 0 || i < iterations) && !k.stopped(); i++ {
+		started := time.Now()
+		k.chargeCartidges(hits, bar, k.callCollection.Cartridges)
+		k.pace(started)
+	}
+}
+
+// stopped check whether the context of a killer is done, so that it sends
+// no more requests
+func (k *Killer) stopped() bool {
+	return k.ctx != nil && k.ctx.Err() != nil
+}
+
+// requestContext get the context that requests of a killer are sent with
+func (k *Killer) requestContext() context.Context {
+	if k == nil || k.requests == nil {
+		return context.Background()
+	}
+	return k.requests
+}
+
+// sleep pause a killer, waking it early when its context is done
+func (k *Killer) sleep(duration time.Duration) {
+	if k.ctx == nil {
+		time.Sleep(duration)
+		return
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-k.ctx.Done():
+	}
+}
+
+func (k *Killer) chargeCartidges(hits chan<- *Hit, bar *pb.ProgressBar, cartridges Cartridges) {
+	for _, cartridge := range cartridges {
+		if k.stopped() {
+			return
+		}
+		switch cartridge.getMethod() {
+		case RANDOM_METHOD, SYNC_METHOD:
+			k.chargeCartidges(hits, bar, cartridge.getChildren(k))
+		case REPEAT_METHOD, IF_METHOD, FOREACH_METHOD:
+			k.chargeFlow(hits, bar, cartridge)
+		default:
+			shot, err := k.load(cartridge)
+			if err != nil {
+				k.run.log("request not created, error: %v", err)
+				continue
+			}
+			k.fire(hits, shot, bar)
+		}
+		if cartridge.think != nil {
+			k.think(cartridge.think)
+		}
+	}
+}
+
+// load build the shot for a request
+func (k *Killer) load(cartridge *Cartridge) (*Shot, error) {
+	// A body is built for any method with params, not only POST
+	hasBody := len(cartridge.chargeFeatures) > 0 || cartridge.body != nil || len(cartridge.files) > 0
+	timeout := k.getTimeout()
+	if cartridge.timeout > 0 {
+		timeout = time.Second * cartridge.timeout
+	}
+
+	shot := new(Shot)
+	shot.cartridge = cartridge
+	shot.client = k.client
+	shot.killer = k
+	shot.auth = k.callCollection.getAuth(cartridge)
+	shot.signing = k.callCollection.getSigning(cartridge)
+	shot.timeout = timeout
+
+	reqURL, err := k.target.url(cartridge.getPathAsString(k))
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(cartridge.getMethod(), reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	k.setFeatures(request, k.callCollection.Features)
+	k.setFeatures(request, cartridge.bulletFeatures)
+	if hasBody {
+		if err := k.chargeBody(request, cartridge); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.run.isDebug() {
+		k.run.log("create request:")
+		dump, _ := httputil.DumpRequest(request, true)
+		k.run.log(string(dump))
+	}
+	shot.request = request
+	return shot, nil
+}
+
+// chargeBody set the body of a request, from uploaded files, the body key or
+// params in that order, setting the content type if needed
+func (k *Killer) chargeBody(request *http.Request, cartridge *Cartridge) error {
+	if len(cartridge.files) > 0 {
+		return k.chargeUpload(request, cartridge)
+	}
+
+	body := new(bytes.Buffer)
+	defer func() {
+		data := body.Bytes()
+		request.Body = ioutil.NopCloser(bytes.NewReader(data))
+		request.ContentLength = int64(len(data))
+		// Lets signing read the body without consuming it
+		request.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+	}()
+
+	if cartridge.body != nil {
+		data, err := cartridge.body.bytes(k)
+		if err != nil {
+			return err
+		}
+		body.Write(data)
+		if len(request.Header.Get("Content-Type")) == 0 {
+			request.Header.Set("Content-Type", cartridge.body.contentType)
+		}
+		return nil
+	}
+
+	// Compare media types only, so charset suffixes and case do not matter
+	switch mediaType(request.Header.Get("Content-Type")) {
+	case "multipart/form-data":
+		writer := multipart.NewWriter(body)
+		for _, feature := range cartridge.chargeFeatures {
+			writer.WriteField(feature.name, feature.String(k))
+		}
+		writer.Close()
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+	case "application/json":
+		// raw_body is kept for configurations written before the body key
+		for _, feature := range cartridge.chargeFeatures {
+			if feature.name == "raw_body" {
+				body.WriteString(feature.String(k))
+			}
+		}
+	default:
+		params := url.Values{}
+		for _, feature := range cartridge.chargeFeatures {
+			params.Set(feature.name, feature.String(k))
+		}
+		body.WriteString(params.Encode())
+		if len(request.Header.Get("Content-Type")) == 0 {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+		}
+	}
+	return nil
+}
+
+// chargeUpload set a multipart body that streams files, with params as
+// form fields
+func (k *Killer) chargeUpload(request *http.Request, cartridge *Cartridge) error {
+	fields := make([][2]string, 0, len(cartridge.chargeFeatures))
+	for _, feature := range cartridge.chargeFeatures {
+		fields = append(fields, [2]string{feature.name, feature.String(k)})
+	}
+	parts := make([]*uploadPart, 0, len(cartridge.files))
+	for _, file := range cartridge.files {
+		part, err := newUploadPart(file, k.rand)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, part)
+	}
+	upload := newMultipartUpload(fields, parts)
+	request.Body = upload
+	request.ContentLength = upload.length()
+	request.Header.Set("Content-Type", upload.contentType())
+	return nil
+}
+
+func (k *Killer) setFeatures(request *http.Request, features Features) {
+	for _, feature := range features {
+		request.Header.Set(feature.name, feature.String(k))
+	}
+}
+
+// fire send a request, and send it again as long as its retry policy asks
+func (k *Killer) fire(hits chan<- *Hit, shot *Shot, bar *pb.ProgressBar) {
+	for attempt := 1; ; attempt++ {
+		hit := k.send(hits, shot)
+		k.backOff(hit.response)
+
+		retry := shot.cartridge.retry
+		if retry != nil && !k.stopped() && retry.shouldRetry(hit, attempt) {
+			// The request is built again, as its body may have been consumed
+			next, err := k.load(shot.cartridge)
+			if err == nil {
+				hit.retried = true
+				hit.discardBody()
+				hits <- hit
+				wait := retry.getDelay(hit, attempt)
+				k.run.log("retry - attempt %v in %v", attempt+1, wait)
+				k.sleep(wait)
+				shot = next
+				continue
+			}
+			k.run.log("request not created for a retry, error: %v", err)
+		}
+
+		// Phases run around the load are not part of its progress
+		if bar != nil {
+			bar.Increment()
+		}
+		k.lastStatus = 0
+		if hit.response != nil {
+			k.lastStatus = hit.response.StatusCode
+			k.extract(shot.cartridge, hit.response, hit.responseBody)
+		}
+		hit.discardBody()
+		hits <- hit
+		return
+	}
+}
+
+// send make one attempt at a request
+func (k *Killer) send(hits chan<- *Hit, shot *Shot) *Hit {
+	k.waitBackoff()
+	k.scenario.limiter.Take()
+
+	// Delay for a random number of milliseconds if configured to
+	if k.run != nil && k.run.attack.RandomDelayMs > 0 {
+		n := k.rand.Intn(k.run.attack.RandomDelayMs) // n will be between 0 and the value
+		k.sleep(time.Duration(n) * time.Millisecond)
+	}
+
+	hit := new(Hit)
+	hit.shot = shot
+
+	// Authenticate as late as possible so that tokens are fresh
+	var err error
+	if shot.auth != nil {
+		err = k.authorize(shot.request, shot.auth, hits)
+	}
+	// Sign last, over the request exactly as it will be sent
+	if err == nil && shot.signing != nil {
+		err = k.sign(shot.request, shot.signing)
+	}
+
+	// The timeout covers the whole exchange, reading the body included
+	ctx, cancel := context.WithTimeout(k.requestContext(), shot.timeout)
+	defer cancel()
+
+	var resp *http.Response
+	hit.startTime = time.Now()
+	if err == nil {
+		resp, err = shot.client.Do(shot.request.WithContext(ctx))
+	}
+	hit.endTime = time.Now()
+	hit.err = err
+	if err == nil {
+		if k.run.isDebug() {
+			dump, _ := httputil.DumpResponse(resp, true)
+			k.run.log(string(dump))
+		}
+		hit.response = resp
+		hit.responseBody, _ = ioutil.ReadAll(resp.Body)
+		hit.bodySize = int64(len(hit.responseBody))
+		resp.Body.Close()
+	} else {
+		k.run.log("response don't received, error: %v", err)
+	}
+	return hit
+}
+
+type Hit struct {
+	startTime time.Time
+	endTime   time.Time
+	shot      *Shot
+	response  *http.Response
+	// dropped once the killer is done with it, only its size being reported
+	responseBody []byte
+	bodySize     int64
+	// why no response was received
+	err error
+	// the attempt was sent again, so it is not counted as a request
+	retried bool
+}
+
+// discardBody drop the body of a response once extractions have run, so that
+// hits waiting to be reported take little memory
+func (h *Hit) discardBody() {
+	h.responseBody = nil
+}
+
+// describeError describe why a hit failed, for the dashboard
+func (h *Hit) describeError() string {
+	if h.err != nil {
+		return h.err.Error()
+	}
+	if h.response != nil {
+		return h.response.Status
+	}
+	return "no response"
+}
+
+// isSuccess check whether a hit got a response with one of the success
+// codes of its request
+func (h *Hit) isSuccess() bool {
+	if h.shot.request == nil || h.response == nil {
+		return false
+	}
+	cartridge := h.shot.cartridge
+	for _, code := range cartridge.failedStatusCodes {
+		if code == h.response.StatusCode {
+			return false
+		}
+	}
+	for _, code := range cartridge.successStatusCodes {
+		if code == h.response.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	HTTP_SCHEME  = "http"
+	HTTPS_SCHEME = "https"
+)
+
+// Target the server requests are sent to. It can be described either with
+// separate scheme, host and port values or with a single base url such as
+// https://[::1]:8443/api/v2, in which case the url path is used as a prefix
+// for every relative request path.
+type Target struct {
+	Scheme   string `yaml:"scheme"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	BaseURL  string `yaml:"base_url"`
+	basePath string
+}
+
+func NewTarget() *Target {
+	return new(Target)
+}
+
+func (v *Target) prepare() error {
+	if len(v.BaseURL) > 0 {
+		baseURL, err := url.Parse(v.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base url: %v", err)
+		}
+		if len(baseURL.Scheme) == 0 || len(baseURL.Host) == 0 {
+			return errors.New("invalid base url: scheme and host are required")
+		}
+		v.Scheme = baseURL.Scheme
+		v.Host = baseURL.Hostname()
+		if len(baseURL.Port()) > 0 {
+			v.Port, err = strconv.Atoi(baseURL.Port())
+			if err != nil {
+				return fmt.Errorf("invalid base url port: %v", err)
+			}
+		}
+		v.basePath = strings.TrimSuffix(baseURL.Path, "/")
+	}
+
+	if len(v.Scheme) > 0 && (v.Scheme != HTTP_SCHEME && v.Scheme != HTTPS_SCHEME) {
+		return errors.New("invalid scheme")
+	}
+
+	// IPv6 literals may be written with or without brackets
+	v.Host = strings.TrimSuffix(strings.TrimPrefix(v.Host, "["), "]")
+	if len(v.Host) == 0 {
+		return errors.New("invalid host")
+	}
+
+	if len(v.Scheme) == 0 {
+		v.Scheme = HTTP_SCHEME
+	}
+
+	if v.Port == 0 {
+		v.Port = v.defaultPort()
+	}
+	return nil
+}
+
+func (v *Target) defaultPort() int {
+	if v.Scheme == HTTPS_SCHEME {
+		return 443
+	}
+	return 80
+}
+
+// address get the host with the port appended when it is not the default for
+// the scheme, bracketing IPv6 literals as needed.
+func (v *Target) address() string {
+	if v.Port == v.defaultPort() {
+		if strings.Contains(v.Host, ":") {
+			return "[" + v.Host + "]"
+		}
+		return v.Host
+	}
+	return net.JoinHostPort(v.Host, strconv.Itoa(v.Port))
+}
+
+// url build the url for a request path. Absolute urls are used as they are so
+// that a script can call services other than the target, relative paths are
+// resolved against the target and its base path.
+func (v *Target) url(path string) (*url.URL, error) {
+	lower := strings.ToLower(path)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return url.Parse(path)
+	}
+
+	reqURL := new(url.URL)
+	reqURL.Scheme = v.Scheme
+	reqURL.Host = v.address()
+
+	pathParts := strings.SplitN(path, "?", 2)
+	reqURL.Path = pathParts[0]
+	if len(v.basePath) > 0 {
+		reqURL.Path = v.basePath + "/" + strings.TrimPrefix(pathParts[0], "/")
+	}
+	if len(pathParts) == 2 {
+		val, _ := url.ParseQuery(pathParts[1])
+		reqURL.RawQuery = val.Encode()
+	} else {
+		reqURL.RawQuery = ""
+	}
+	return reqURL, nil
+}
@@ -0,0 +1,54 @@
+package lib
+
+import "testing"
+
+func TestTargetURL(t *testing.T) {
+	tests := []struct {
+		target Target
+		path   string
+		want   string
+	}{
+		{Target{Host: "example.com"}, "/index?b=2&a=1", "http://example.com/index?a=1&b=2"},
+		{Target{Scheme: "https", Host: "example.com"}, "/", "https://example.com/"},
+		{Target{Host: "example.com", Port: 8080}, "/", "http://example.com:8080/"},
+		{Target{Host: "::1", Port: 8080}, "/", "http://[::1]:8080/"},
+		{Target{Scheme: "https", Host: "[::1]"}, "/", "https://[::1]/"},
+		{Target{BaseURL: "https://[::1]:8443/api/v2/"}, "/users", "https://[::1]:8443/api/v2/users"},
+		{Target{BaseURL: "https://example.com/api"}, "users?id=1", "https://example.com/api/users?id=1"},
+		{Target{BaseURL: "https://example.com/api"}, "http://other.example.com/x", "http://other.example.com/x"},
+		{Target{Host: "example.com"}, "/login?next=https://foo.example.com/x", "http://example.com/login?next=https%3A%2F%2Ffoo.example.com%2Fx"},
+		{Target{Host: "example.com"}, "HTTPS://other.example.com/x", "https://other.example.com/x"},
+	}
+	for _, test := range tests {
+		target := test.target
+		if err := target.prepare(); err != nil {
+			t.Fatalf("prepare %+v: %v", test.target, err)
+		}
+		got, err := target.url(test.path)
+		if err != nil {
+			t.Fatalf("url %s: %v", test.path, err)
+		}
+		if got.String() != test.want {
+			t.Errorf("url %s got %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+func TestTargetDefaultPort(t *testing.T) {
+	target := Target{Scheme: "https", Host: "example.com"}
+	if err := target.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if target.Port != 443 {
+		t.Errorf("got port %d, want 443", target.Port)
+	}
+}
+
+func TestAttackPrepareWithoutRun(t *testing.T) {
+	attack := new(Attack)
+	attack.SetTarget(NewTarget())
+	attack.SetGun(new(CallCollection))
+	if err := attack.Prepare(); err == nil {
+		t.Error("expected an error for an attack that is not part of a run")
+	}
+}
@@ -0,0 +1,247 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// METRICS_PATH the path Prometheus scrapes the metrics of a run at
+const METRICS_PATH = "/metrics"
+
+// metricsBuckets the upper bounds in seconds of the response time histograms
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics the counters of a run in the Prometheus text format, updated as
+// hits arrive
+type Metrics struct {
+	mutex     sync.Mutex
+	run       *Run
+	requests  map[metricKey]int64
+	durations map[metricKey]*metricHistogram
+	errors    map[metricKey]int64
+	retries   map[metricKey]int64
+	sent      int64
+	received  int64
+}
+
+// metricKey the labels of a series. value is the status of a request, or the
+// type of an error.
+type metricKey struct {
+	request string
+	method  string
+	value   string
+}
+
+// metricHistogram the response times of a request in cumulative buckets
+type metricHistogram struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// NewMetrics create the metrics of a run
+func NewMetrics(run *Run) *Metrics {
+	return &Metrics{
+		run:       run,
+		requests:  make(map[metricKey]int64),
+		durations: make(map[metricKey]*metricHistogram),
+		errors:    make(map[metricKey]int64),
+		retries:   make(map[metricKey]int64),
+	}
+}
+
+// add count a hit in the metrics
+func (m *Metrics) add(hit *Hit) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cartridge := hit.shot.cartridge
+	key := metricKey{request: fmt.Sprintf("%v", cartridge.path.rawDescription), method: cartridge.getMethod()}
+	if hit.shot.request != nil && hit.shot.request.ContentLength > 0 {
+		m.sent += hit.shot.request.ContentLength
+	}
+	m.received += hit.bodySize
+	if hit.retried {
+		m.retries[key]++
+		return
+	}
+
+	status := 0
+	if hit.response != nil {
+		status = hit.response.StatusCode
+	}
+	m.requests[metricKey{key.request, key.method, strconv.Itoa(status)}]++
+
+	histogram, ok := m.durations[key]
+	if !ok {
+		histogram = &metricHistogram{counts: make([]int64, len(metricsBuckets))}
+		m.durations[key] = histogram
+	}
+	seconds := hit.endTime.Sub(hit.startTime).Seconds()
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			histogram.counts[i]++
+		}
+	}
+	histogram.sum += seconds
+	histogram.count++
+
+	if !hit.isSuccess() {
+		m.errors[metricKey{key.request, key.method, hit.getErrorType()}]++
+	}
+}
+
+// ServeHTTP write the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write write the metrics in the Prometheus text format
+func (m *Metrics) write(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writeHeader(w, "mgun_requests_total", "counter", "Requests sent, by request, method and status, 0 for no response.")
+	for _, key := range getMetricKeys(m.requests) {
+		fmt.Fprintf(w, "mgun_requests_total{%s,status=%s} %d\n", key.labels(), quoteLabel(key.value), m.requests[key])
+	}
+
+	writeHeader(w, "mgun_request_duration_seconds", "histogram", "Response times, by request and method.")
+	keys := make([]metricKey, 0, len(m.durations))
+	for key := range m.durations {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	for _, key := range keys {
+		histogram := m.durations[key]
+		for i, bound := range metricsBuckets {
+			fmt.Fprintf(w, "mgun_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", key.labels(), strconv.FormatFloat(bound, 'g', -1, 64), histogram.counts[i])
+		}
+		fmt.Fprintf(w, "mgun_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), histogram.count)
+		fmt.Fprintf(w, "mgun_request_duration_seconds_sum{%s} %s\n", key.labels(), strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "mgun_request_duration_seconds_count{%s} %d\n", key.labels(), histogram.count)
+	}
+
+	writeHeader(w, "mgun_errors_total", "counter", "Failed requests, by request, method and type: timeout, connection, status or other.")
+	for _, key := range getMetricKeys(m.errors) {
+		fmt.Fprintf(w, "mgun_errors_total{%s,type=%s} %d\n", key.labels(), quoteLabel(key.value), m.errors[key])
+	}
+
+	writeHeader(w, "mgun_retries_total", "counter", "Attempts that were sent again, by request and method.")
+	for _, key := range getMetricKeys(m.retries) {
+		fmt.Fprintf(w, "mgun_retries_total{%s} %d\n", key.labels(), m.retries[key])
+	}
+
+	writeHeader(w, "mgun_bytes_sent_total", "counter", "Bytes of request bodies sent.")
+	fmt.Fprintf(w, "mgun_bytes_sent_total %d\n", m.sent)
+	writeHeader(w, "mgun_bytes_received_total", "counter", "Bytes of response bodies received.")
+	fmt.Fprintf(w, "mgun_bytes_received_total %d\n", m.received)
+
+	writeHeader(w, "mgun_active_vus", "gauge", "Virtual users running their script.")
+	fmt.Fprintf(w, "mgun_active_vus %d\n", atomic.LoadInt32(&m.run.activeVUs))
+	writeHeader(w, "mgun_vus", "gauge", "Virtual users of the run.")
+	fmt.Fprintf(w, "mgun_vus %d\n", m.run.attack.getVirtualUsers())
+}
+
+// labels get the request and method labels of a series
+func (k metricKey) labels() string {
+	return fmt.Sprintf("request=%s,method=%s", quoteLabel(k.request), quoteLabel(k.method))
+}
+
+// writeHeader write the help and type of a metric
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// quoteLabel quote a label value, escaping what the text format requires
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// getMetricKeys get the keys of counters in a stable order
+func getMetricKeys(counters map[metricKey]int64) []metricKey {
+	keys := make([]metricKey, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sortMetricKeys(keys)
+	return keys
+}
+
+// sortMetricKeys sort keys by request, method and value
+func sortMetricKeys(keys []metricKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].request != keys[j].request {
+			return keys[i].request < keys[j].request
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].value < keys[j].value
+	})
+}
+
+// getErrorType get why a hit failed: a timeout, a connection that failed, a
+// status that is not a success, or another error
+func (h *Hit) getErrorType() string {
+	if h.err == nil {
+		if h.response != nil {
+			return "status"
+		}
+		return "other"
+	}
+	var netErr net.Error
+	if errors.Is(h.err, context.DeadlineExceeded) || (errors.As(h.err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+	var opErr *net.OpError
+	if errors.As(h.err, &opErr) {
+		return "connection"
+	}
+	return "other"
+}
+
+// ServeMetrics serve the metrics of the run for Prometheus at /metrics on an
+// address such as :9102 until linger after the attack or the capacity search
+// is over
+func (r *Run) ServeMetrics(address string, linger time.Duration) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	r.metrics = NewMetrics(r)
+	mux := http.NewServeMux()
+	mux.Handle(METRICS_PATH, r.metrics)
+	r.metricsServer = &http.Server{Handler: mux}
+	r.metricsLinger = linger
+	go r.metricsServer.Serve(listener)
+	return nil
+}
+
+// closeMetrics stop serving the metrics of the run, once they have been
+// served for linger after it. A run that was interrupted stops right away.
+func (r *Run) closeMetrics(ctx context.Context) {
+	if r.metricsServer != nil {
+		if r.metricsLinger > 0 && ctx.Err() == nil {
+			fmt.Printf("Serving metrics for another %v for a last scrape\n", r.metricsLinger)
+			time.Sleep(r.metricsLinger)
+		}
+		r.metricsServer.Close()
+		r.metricsServer = nil
+	}
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	cartridge := &Cartridge{id: 1, path: NewNamedFeature(POST_METHOD), successStatusCodes: []int{200}}
+	cartridge.path.rawDescription = `/items/"${id}"`
+	request, _ := http.NewRequest(POST_METHOD, "http://example.com/items/1", strings.NewReader("hello"))
+	newHit := func(status int, err error, took time.Duration) *Hit {
+		now := time.Now()
+		hit := &Hit{shot: &Shot{cartridge: cartridge, request: request}, err: err, startTime: now.Add(-took), endTime: now}
+		if status > 0 {
+			hit.response = &http.Response{StatusCode: status}
+			hit.bodySize = 10
+		}
+		return hit
+	}
+
+	run := &Run{attack: &Attack{scenarios: []*Scenario{{vus: 4}}}, activeVUs: 3}
+	metrics := NewMetrics(run)
+	metrics.add(newHit(200, nil, 20*time.Millisecond))
+	metrics.add(newHit(200, nil, 200*time.Millisecond))
+	metrics.add(newHit(503, nil, time.Millisecond))
+	metrics.add(newHit(0, fmt.Errorf("get: %w", context.DeadlineExceeded), 2*time.Second))
+	metrics.add(newHit(0, errors.New("malformed response"), time.Millisecond))
+	retried := newHit(429, nil, time.Millisecond)
+	retried.retried = true
+	metrics.add(retried)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(GET_METHOD, METRICS_PATH, nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	labels := `request="/items/\"${id}\"",method="POST"`
+	for _, line := range []string{
+		"# TYPE mgun_requests_total counter",
+		`mgun_requests_total{` + labels + `,status="200"} 2`,
+		`mgun_requests_total{` + labels + `,status="503"} 1`,
+		`mgun_requests_total{` + labels + `,status="0"} 2`,
+		"# TYPE mgun_request_duration_seconds histogram",
+		`mgun_request_duration_seconds_bucket{` + labels + `,le="0.025"} 3`,
+		`mgun_request_duration_seconds_bucket{` + labels + `,le="0.25"} 4`,
+		`mgun_request_duration_seconds_bucket{` + labels + `,le="+Inf"} 5`,
+		`mgun_request_duration_seconds_count{` + labels + `} 5`,
+		`mgun_errors_total{` + labels + `,type="other"} 1`,
+		`mgun_errors_total{` + labels + `,type="status"} 1`,
+		`mgun_errors_total{` + labels + `,type="timeout"} 1`,
+		`mgun_retries_total{` + labels + `} 1`,
+		"mgun_bytes_sent_total 30",
+		"mgun_bytes_received_total 40",
+		"mgun_active_vus 3",
+		"mgun_vus 4",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("expected the line %s in:\n%s", line, body)
+		}
+	}
+}
+
+func TestServeMetricsLinger(t *testing.T) {
+	run, err := NewRun([]byte("host: localhost\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	if err := run.ServeMetrics(address, 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		run.closeMetrics(context.Background())
+		close(closed)
+	}()
+	// The run is over, and the metrics can still be scraped
+	response, err := http.Get("http://" + address + METRICS_PATH)
+	if err != nil {
+		t.Fatalf("expected the metrics to be served after the run: %v", err)
+	}
+	response.Body.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the metrics to close after the linger")
+	}
+	if _, err := http.Get("http://" + address + METRICS_PATH); err == nil {
+		t.Error("expected the metrics to be closed")
+	}
+}
+
+func TestServeMetricsInterrupted(t *testing.T) {
+	run, err := NewRun([]byte("host: localhost\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := run.ServeMetrics("127.0.0.1:0", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := time.Now()
+	run.closeMetrics(ctx)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("got a linger of %v, want none after an interrupted run", elapsed)
+	}
+}
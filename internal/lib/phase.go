@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"context"
+
+	"go.uber.org/ratelimit"
+)
+
+const (
+	PHASE_SETUP    = "Setup"
+	PHASE_VU_SETUP = "VU setup"
+	PHASE_TEARDOWN = "Teardown"
+)
+
+// phases the phases run around the load, in the order they are reported
+var phases = []string{PHASE_SETUP, PHASE_VU_SETUP, PHASE_TEARDOWN}
+
+// setPhase mark cartridges as part of a phase rather than of the load, so
+// that they are reported on their own
+func (c Cartridges) setPhase(phase string) {
+	for _, cartridge := range c {
+		cartridge.phase = phase
+		cartridge.children.setPhase(phase)
+		cartridge.elseChildren.setPhase(phase)
+	}
+}
+
+// getPhaseCartridges get the cartridges of a phase
+func (cc *CallCollection) getPhaseCartridges(phase string) Cartridges {
+	switch phase {
+	case PHASE_SETUP:
+		return cc.Setup
+	case PHASE_VU_SETUP:
+		return cc.VUSetup
+	case PHASE_TEARDOWN:
+		return cc.Teardown
+	}
+	return Cartridges{}
+}
+
+// preparePhases mark the cartridges of the phases of a collection
+func (cc *CallCollection) preparePhases() {
+	for _, phase := range phases {
+		cc.getPhaseCartridges(phase).setPhase(phase)
+	}
+}
+
+// newPhaseKiller create the killer that runs setup and teardown. It is not
+// rate limited and its variables are shared with every virtual user. Like a
+// virtual user it stops between two requests when ctx is done, and its
+// requests are cancelled along with requests.
+func (a *Attack) newPhaseKiller(ctx context.Context, requests context.Context) *Killer {
+	killer := new(Killer)
+	killer.run = a.run
+	killer.ctx = ctx
+	killer.requests = requests
+	killer.setTarget(a.target)
+	killer.setGun(a.callCollection)
+	killer.scenario = &Scenario{
+		callCollection: a.callCollection,
+		limiter:        ratelimit.NewUnlimited(),
+	}
+	killer.prepare()
+	return killer
+}
+
+// runPhase run the requests of a phase, reporting them without counting them
+// in the progress of the load
+func (k *Killer) runPhase(hits chan<- *Hit, phase string) {
+	cartridges := k.callCollection.getPhaseCartridges(phase)
+	if len(cartridges) == 0 {
+		return
+	}
+	k.run.log("%v phase", phase)
+	k.chargeCartidges(hits, nil, cartridges)
+}
+
+// shareVars give a killer a copy of the variables of another, such as those
+// set during setup
+func (k *Killer) shareVars(from *Killer) {
+	for name, value := range from.vars {
+		k.setVar(name, value)
+	}
+}
@@ -0,0 +1,439 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tm "github.com/buger/goterm"
+	hm "github.com/dustin/go-humanize"
+)
+
+const (
+	// EmptySign empty string
+	EmptySign = ""
+)
+
+// Reporter flags for reporting
+type Reporter struct {
+	Debug  bool   `yaml:"debug"`
+	Output string `yaml:"output"`
+	// seconds between two lines of statistics while the attack runs, none
+	// when 0
+	StatsInterval float64 `yaml:"stats_interval"`
+	// a full screen view of the attack instead of the progress bar
+	Dashboard bool `yaml:"dashboard"`
+	// metrics systems results are pushed to while the attack runs
+	Sinks []*Sink `yaml:"sinks"`
+}
+
+func (r *Reporter) log(message string, args ...interface{}) {
+	if r.Debug {
+		message = fmt.Sprintf(message, args...)
+		fmt.Println(message)
+	}
+}
+
+func (r *Reporter) ln() {
+	r.log(EmptySign)
+}
+
+// report print the statistics of an attack once its hits are all in, and
+// write them to the output file. The report is marked as interrupted when the
+// context of the attack was done before it finished.
+func (r *Reporter) report(ctx context.Context, attack *Attack, stats *Stats) {
+	notice := EmptySign
+	if ctx.Err() != nil {
+		notice = "Interrupted, the report covers the requests completed until then"
+	}
+	r.print(attack, stats, notice, true)
+}
+
+// print print the statistics of an attack so far, with a notice above them
+// when it is not empty, and write them to the output file if asked to
+func (r *Reporter) print(attack *Attack, stats *Stats, notice string, write bool) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	reports := stats.reports
+	rates := stats.rates
+
+	hitsTable := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(hitsTable, "#\tRequest\n")
+	fmt.Fprintf(hitsTable, "\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-1s\t%-10s\t%-7s\n", "Compl", "Fail.", "Min/s", "Max/s", "Avg/s.", "Avail%", "Min/Ave/Max req/s. ", "Cont len", "Total trans")
+
+	var totalRequests int
+	var completeRequests int
+	var failedRequests int
+	var availability float64
+	var totalRequestPerSeconds float64
+	var totalTransferred int64
+
+	reportsCount := 0.0
+	// Requests are listed per scenario, counting cartridges shared between
+	// scenarios once
+	counted := make(map[int]bool)
+	for _, scenario := range attack.scenarios {
+		cartridges := scenario.callCollection.getReportCartridges()
+		if len(scenario.name) > 0 {
+			fmt.Fprintf(hitsTable, "\tScenario %s, %d virtual users\n\n", scenario.name, scenario.vus)
+		}
+		for _, cartridge := range cartridges {
+			if counted[cartridge.id] {
+				continue
+			}
+			counted[cartridge.id] = true
+
+			if report, ok := reports[cartridge.id]; ok {
+				avgRequestPerSecond := r.writeRequestReport(hitsTable, cartridge, report, rates)
+				reportsCount++
+				totalRequests += report.totalRequests
+				completeRequests += report.completeRequests
+				failedRequests += report.failedRequests
+				availability += report.getAvailability()
+				totalTransferred += report.totalTransferred
+				totalRequestPerSeconds += avgRequestPerSecond
+			}
+		}
+	}
+	phasesTable := r.getPhasesTable(attack, reports, rates)
+	retriesTable := r.getRetriesTable(attack, stats.retries)
+
+	targetTable := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(targetTable, "Server Hostname:\t%s\n", attack.target.Host)
+	fmt.Fprintf(targetTable, "Server Port:\t%d\n", attack.target.Port)
+	if len(attack.target.basePath) > 0 {
+		fmt.Fprintf(targetTable, "Base path:\t%s\n", attack.target.basePath)
+	}
+	fmt.Fprintf(targetTable, "Concurrency Level:\t%d\n", attack.CallCollectionCount)
+	fmt.Fprintf(targetTable, "Rate per second:\t%d\n", attack.Rate)
+	fmt.Fprintf(targetTable, "Random delay ms:\t%d\n", attack.RandomDelayMs)
+	fmt.Fprintf(targetTable, "Loop count:\t%d\n", attack.AttemptsCount)
+	fmt.Fprintf(targetTable, "Timeout:\t%d seconds\n", attack.Timeout)
+	fmt.Fprintf(targetTable, "Time taken for tests:\t%d seconds\n", int(time.Unix(stats.endTime, 0).Sub(time.Unix(stats.startTime, 0)).Seconds()))
+	fmt.Fprintf(targetTable, "Total requests:\t%d\n", totalRequests)
+	fmt.Fprintf(targetTable, "Complete requests:\t%d\n", completeRequests)
+	fmt.Fprintf(targetTable, "Failed requests:\t%d\n", failedRequests)
+	if stats.retriesCount > 0 {
+		fmt.Fprintf(targetTable, "Retried attempts:\t%d\n", stats.retriesCount)
+	}
+	// No request may be done yet when a report is made during the attack
+	if reportsCount > 0 {
+		availability /= reportsCount
+	}
+	fmt.Fprintf(targetTable, "Availability:\t%.2f%%\n", availability)
+	fmt.Fprintf(targetTable, "Requests per second:\t~ %.2f\n", totalRequestPerSeconds/float64(len(counted)))
+	fmt.Fprintf(targetTable, "Total transferred:\t%s\n", hm.Bytes(uint64(totalTransferred)))
+
+	// Only break statistics down by host when the script spans several
+	// services, and by scenario when there are several
+	hostsTable := r.getBreakdownTable("Host", stats.hostReports)
+	scenariosTable := r.getBreakdownTable("Scenario", stats.scenarioReports)
+
+	fmt.Println(EmptySign)
+	fmt.Println(EmptySign)
+	if notice != EmptySign {
+		fmt.Println(notice)
+		fmt.Println(EmptySign)
+	}
+	fmt.Println(targetTable)
+	fmt.Println(hitsTable)
+	if phasesTable != nil {
+		fmt.Println(phasesTable)
+	}
+	if retriesTable != nil {
+		fmt.Println(retriesTable)
+	}
+	if scenariosTable != nil {
+		fmt.Println(scenariosTable)
+	}
+	if hostsTable != nil {
+		fmt.Println(hostsTable)
+	}
+
+	// Write output if something has been specified in config or as commandline option
+	if write && r.Output != "" {
+		var b strings.Builder
+		if notice != EmptySign {
+			fmt.Fprintln(&b, notice)
+			fmt.Fprintln(&b)
+		}
+		fmt.Fprintln(&b, targetTable)
+		fmt.Fprintln(&b, hitsTable)
+		if phasesTable != nil {
+			fmt.Fprintln(&b, phasesTable)
+		}
+		if retriesTable != nil {
+			fmt.Fprintln(&b, retriesTable)
+		}
+		if scenariosTable != nil {
+			fmt.Fprintln(&b, scenariosTable)
+		}
+		if hostsTable != nil {
+			fmt.Fprintln(&b, hostsTable)
+		}
+		r.writeOutput(b.String())
+	}
+}
+
+// prepareSinks check the settings of the sinks
+func (r *Reporter) prepareSinks() error {
+	for i, sink := range r.Sinks {
+		if err := sink.prepare(); err != nil {
+			return fmt.Errorf("sink %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// writeOutput write a report to the output file
+func (r *Reporter) writeOutput(report string) {
+	err := ioutil.WriteFile(r.Output, []byte(report), 0644)
+	if err != nil {
+		fmt.Printf("Problem writing report to file %s, %v\n", r.Output, err)
+	} else {
+		fmt.Printf("Wrote report to file %s\n", r.Output)
+	}
+}
+
+// writeRequestReport write the statistics of a request to a table, returning
+// its average requests per second
+func (r *Reporter) writeRequestReport(table *tm.Table, cartridge *Cartridge, report *RequestReport, rates map[int]*rateCounter) float64 {
+	var minRequestPerSecond int64
+	var avgRequestPerSecond float64
+	var maxRequestPerSecond int64
+	if rate, ok := rates[cartridge.id]; ok {
+		minRequestPerSecond, avgRequestPerSecond, maxRequestPerSecond = rate.get()
+	}
+
+	fmt.Fprintf(
+		table, "%d.\t%s\n",
+		cartridge.id,
+		r.getRequestName(cartridge),
+	)
+
+	fmt.Fprintf(
+		table, "\t%-8d\t%-8d\t%-8.3f\t%-8.3f\t%-8.3f\t%-8.2f\t%-2d/ ~ %-2.2f / %-6d\t%-10s\t%-6s\n\n",
+		report.completeRequests,
+		report.failedRequests,
+		report.minTime,
+		report.maxTime,
+		report.getAvgTime(),
+		report.getAvailability(),
+		minRequestPerSecond,
+		avgRequestPerSecond,
+		maxRequestPerSecond,
+		hm.Bytes(uint64(report.contentLength)),
+		hm.Bytes(uint64(report.totalTransferred)),
+	)
+	return avgRequestPerSecond
+}
+
+// getPhasesTable get a table of the requests of setup, vu_setup and teardown,
+// or nil if there were none
+func (r *Reporter) getPhasesTable(attack *Attack, reports map[int]*RequestReport, rates map[int]*rateCounter) *tm.Table {
+	var table *tm.Table
+	counted := make(map[int]bool)
+	for _, phase := range phases {
+		cartridges := attack.callCollection.getPhaseCartridges(phase).toPlainSlice()
+		if phase == PHASE_VU_SETUP {
+			cartridges = make(Cartridges, 0)
+			for _, scenario := range attack.scenarios {
+				cartridges = append(cartridges, scenario.callCollection.VUSetup.toPlainSlice()...)
+			}
+		}
+		written := false
+		for _, cartridge := range cartridges {
+			report, ok := reports[cartridge.id]
+			if !ok || counted[cartridge.id] {
+				continue
+			}
+			counted[cartridge.id] = true
+			if table == nil {
+				table = tm.NewTable(0, 0, 2, ' ', 0)
+				fmt.Fprintf(table, "#\tPhase request\n")
+				fmt.Fprintf(table, "\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-1s\t%-10s\t%-7s\n", "Compl", "Fail.", "Min/s", "Max/s", "Avg/s.", "Avail%", "Min/Ave/Max req/s. ", "Cont len", "Total trans")
+			}
+			if !written {
+				written = true
+				fmt.Fprintf(table, "\t%s\n\n", phase)
+			}
+			r.writeRequestReport(table, cartridge, report, rates)
+		}
+	}
+	return table
+}
+
+// getRetriesTable get a table of the attempts that were retried, by request
+// and status, or nil if there were none
+func (r *Reporter) getRetriesTable(attack *Attack, retries map[int]map[int]int) *tm.Table {
+	if len(retries) == 0 {
+		return nil
+	}
+	cartridges := make(map[int]*Cartridge)
+	all := append(attack.callCollection.Setup.toPlainSlice(), attack.callCollection.Teardown.toPlainSlice()...)
+	for _, scenario := range attack.scenarios {
+		all = append(all, scenario.callCollection.getReportCartridges()...)
+		all = append(all, scenario.callCollection.VUSetup.toPlainSlice()...)
+	}
+	for _, cartridge := range all {
+		cartridges[cartridge.id] = cartridge
+	}
+	ids := make([]int, 0, len(retries))
+	for id := range retries {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	table := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "#\tRetried request\tAttempts\tStatuses\n")
+	for _, id := range ids {
+		statuses := make([]int, 0, len(retries[id]))
+		count := 0
+		for status, statusCount := range retries[id] {
+			statuses = append(statuses, status)
+			count += statusCount
+		}
+		sort.Ints(statuses)
+		descriptions := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			description := strconv.Itoa(status)
+			if status == 0 {
+				description = "no response"
+			}
+			descriptions = append(descriptions, fmt.Sprintf("%s x %d", description, retries[id][status]))
+		}
+		name := ""
+		if cartridge, ok := cartridges[id]; ok {
+			name = r.getRequestName(cartridge)
+		}
+		fmt.Fprintf(table, "%d.\t%s\t%d\t%s\n", id, name, count, strings.Join(descriptions, ", "))
+	}
+	return table
+}
+
+// getBreakdownTable get a table of statistics per host or scenario, or nil if
+// there is only one
+func (r *Reporter) getBreakdownTable(title string, reports map[string]*RequestReport) *tm.Table {
+	if len(reports) < 2 {
+		return nil
+	}
+	keys := make([]string, 0, len(reports))
+	for key := range reports {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	table := tm.NewTable(0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "%s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-8s\t%-7s\n", title, "Compl", "Fail.", "Min/s", "Max/s", "Avg/s.", "Avail%", "Total trans")
+	for _, key := range keys {
+		report := reports[key]
+		fmt.Fprintf(
+			table, "%s\t%-8d\t%-8d\t%-8.3f\t%-8.3f\t%-8.3f\t%-8.2f\t%-6s\n",
+			key,
+			report.completeRequests,
+			report.failedRequests,
+			report.minTime,
+			report.maxTime,
+			report.getAvgTime(),
+			report.getAvailability(),
+			hm.Bytes(uint64(report.totalTransferred)),
+		)
+	}
+	return table
+}
+
+func (r *Reporter) getRequestName(cartridge *Cartridge) string {
+	return fmt.Sprintf("%s %s", cartridge.getMethod(), cartridge.path.rawDescription)
+}
+
+func NewRequestReport(hit *Hit) *RequestReport {
+	return new(RequestReport).create(hit)
+}
+
+type RequestReport struct {
+	totalRequests     int
+	startTime         time.Time
+	endTime           time.Time
+	minTime           float64
+	maxTime           float64
+	completeRequests  int
+	failedRequests    int
+	requestsPerSecond float64
+	totalTransferred  int64
+	totalTime         float64
+	contentLength     int64
+}
+
+func (this *RequestReport) create(hit *Hit) *RequestReport {
+	timeRequest := this.getDiffSeconds(hit)
+	this.minTime = timeRequest
+	this.maxTime = timeRequest
+	this.totalTime = timeRequest
+	this.updateTotalRequests()
+	this.updateTotalTransferred(hit)
+	this.checkResponseStatusCode(hit)
+	this.startTime = hit.startTime
+	this.endTime = hit.endTime
+	return this
+}
+
+func (sr *RequestReport) getDiffSeconds(hit *Hit) float64 {
+	return hit.endTime.Sub(hit.startTime).Seconds()
+}
+
+func (sr *RequestReport) checkResponseStatusCode(hit *Hit) {
+	if hit.isSuccess() {
+		sr.completeRequests++
+	} else {
+		sr.failedRequests++
+	}
+}
+
+func (sr *RequestReport) updateTotalRequests() {
+	sr.totalRequests++
+}
+
+func (sr *RequestReport) updateTotalTransferred(hit *Hit) {
+	if hit.response != nil {
+		sr.totalTransferred += hit.bodySize
+		if sr.contentLength == 0 {
+			sr.contentLength = sr.totalTransferred
+		}
+	}
+}
+
+func (sr *RequestReport) updateRequestsPerSecond(timeRequest float64) {
+	if timeRequest == 0 {
+		timeRequest = 1
+	}
+	if sr.requestsPerSecond == 0 {
+		sr.requestsPerSecond = 1 / timeRequest
+	} else {
+		sr.requestsPerSecond = ((1 / timeRequest) + sr.requestsPerSecond) / 2
+	}
+}
+
+func (sr *RequestReport) update(hit *Hit) *RequestReport {
+	timeRequest := sr.getDiffSeconds(hit)
+	sr.minTime = math.Min(sr.minTime, timeRequest)
+	sr.maxTime = math.Max(sr.maxTime, timeRequest)
+	sr.totalTime += timeRequest
+	sr.updateTotalRequests()
+	sr.updateTotalTransferred(hit)
+	sr.checkResponseStatusCode(hit)
+	sr.endTime = hit.endTime
+	return sr
+}
+
+func (sr *RequestReport) getAvgTime() float64 {
+	return (sr.minTime + sr.maxTime) / 2
+}
+
+func (sr *RequestReport) getAvailability() float64 {
+	return float64(sr.completeRequests) * 100 / float64(sr.totalRequests)
+}
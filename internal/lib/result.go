@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Result the statistics of an attack run from code rather than the command
+// line
+type Result struct {
+	Duration time.Duration
+	Requests []*RequestResult
+	// attempts that were sent again, not counted in the requests
+	Retries int
+}
+
+// RequestResult the statistics of a request of the script, in script order
+type RequestResult struct {
+	ID       int
+	Name     string
+	Scenario string
+	Phase    string
+	Requests int
+	Failures int
+	Statuses map[int]int
+	Min      time.Duration
+	Mean     time.Duration
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	Bytes    int64
+}
+
+// Run run an attack without printing anything, and return its statistics.
+// Virtual users run their script loopcount times, or for the given duration
+// when it is not 0, and stop between two requests when the context is done.
+func (a *Attack) Run(ctx context.Context, duration time.Duration) *Result {
+	a.setRateLimit()
+	iterations := a.AttemptsCount
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+		iterations = 0
+	}
+
+	result := new(Result)
+	started := time.Now()
+	a.launch(ctx, iterations, false, func(hits <-chan *Hit) {
+		requests := make(map[int]*RequestResult)
+		durations := make(map[int]*Histogram)
+		for hit := range hits {
+			if hit.retried {
+				result.Retries++
+				continue
+			}
+			cartridge := hit.shot.cartridge
+			request, ok := requests[cartridge.id]
+			if !ok {
+				request = &RequestResult{
+					ID:       cartridge.id,
+					Name:     a.run.reporter.getRequestName(cartridge),
+					Phase:    cartridge.phase,
+					Statuses: make(map[int]int),
+				}
+				if hit.shot.killer != nil && hit.shot.killer.scenario != nil {
+					request.Scenario = hit.shot.killer.scenario.name
+				}
+				requests[cartridge.id] = request
+				durations[cartridge.id] = NewHistogram()
+			}
+			request.Requests++
+			if !hit.isSuccess() {
+				request.Failures++
+			}
+			if hit.response != nil {
+				request.Statuses[hit.response.StatusCode]++
+			}
+			request.Bytes += hit.bodySize
+			durations[cartridge.id].record(hit.endTime.Sub(hit.startTime))
+		}
+
+		for id, request := range requests {
+			request.setDurations(durations[id])
+			result.Requests = append(result.Requests, request)
+		}
+		sort.Slice(result.Requests, func(i, j int) bool {
+			return result.Requests[i].ID < result.Requests[j].ID
+		})
+	})
+	result.Duration = time.Since(started)
+	return result
+}
+
+// setDurations set the response time statistics of a request
+func (r *RequestResult) setDurations(durations *Histogram) {
+	if durations.count() == 0 {
+		return
+	}
+	r.Min = durations.min
+	r.Max = durations.max
+	r.Mean = durations.mean()
+	r.P50 = durations.percentile(50)
+	r.P95 = durations.percentile(95)
+	r.P99 = durations.percentile(99)
+}
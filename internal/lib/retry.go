@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff how virtual users slow down when the server says it is overloaded
+//
+//	backoff:
+//	  respect_retry_after: true  wait as long as Retry-After asks on 429 and 503
+//	  statuses: [503]            backed off exponentially without Retry-After
+//	  initial: 1                 seconds of the first wait
+//	  multiplier: 2
+//	  max: 30                    seconds of the longest wait
+//
+// A virtual user waits before its next request and goes back to full speed
+// after a response with another status. respect_retry_after can also be set
+// on its own at the top level to only honour Retry-After. Retry-After waits
+// are cut to max too.
+type Backoff struct {
+	respectRetryAfter bool
+	statuses          []int
+	initial           time.Duration
+	multiplier        float64
+	max               time.Duration
+}
+
+func (b *Backoff) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	var rawBackoff interface{}
+	if err := unmarshal(&rawBackoff); err != nil {
+		return err
+	}
+	backoff, err := NewBackoff(rawBackoff)
+	if err != nil {
+		return err
+	}
+	*b = *backoff
+	return nil
+}
+
+// NewBackoff create a backoff policy from its raw configuration value
+func NewBackoff(rawValue interface{}) (*Backoff, error) {
+	backoff := &Backoff{
+		respectRetryAfter: true,
+		statuses:          []int{http.StatusServiceUnavailable},
+		initial:           time.Second,
+		multiplier:        2,
+		max:               30 * time.Second,
+	}
+	rawBackoff, ok := rawValue.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("backoff must be a map")
+	}
+	for rawKey, rawValue := range rawBackoff {
+		key := fmt.Sprintf("%v", rawKey)
+		switch key {
+		case "respect_retry_after":
+			respect, ok := rawValue.(bool)
+			if !ok {
+				return nil, fmt.Errorf("backoff respect_retry_after must be true or false")
+			}
+			backoff.respectRetryAfter = respect
+		case "statuses":
+			backoff.statuses = new(Cartridges).getCodes(rawValue)
+		case "initial", "max":
+			seconds, ok := toFloat(rawValue)
+			if !ok || seconds <= 0 {
+				return nil, fmt.Errorf("backoff %s must be a positive number of seconds", key)
+			}
+			if key == "initial" {
+				backoff.initial = toDuration(seconds)
+			} else {
+				backoff.max = toDuration(seconds)
+			}
+		case "multiplier":
+			multiplier, ok := toFloat(rawValue)
+			if !ok || multiplier < 1 {
+				return nil, fmt.Errorf("backoff multiplier must be at least 1")
+			}
+			backoff.multiplier = multiplier
+		default:
+			return nil, fmt.Errorf("unknown backoff option %s", key)
+		}
+	}
+	return backoff, nil
+}
+
+// getDelay get the wait after a number of backed off responses in a row
+func (b *Backoff) getDelay(count int) time.Duration {
+	delay := float64(b.initial) * math.Pow(b.multiplier, float64(count-1))
+	return time.Duration(math.Min(delay, float64(b.max)))
+}
+
+// Retry how a request is sent again when it fails, given per request
+//
+//	retry: 3
+//	retry:
+//	  attempts: 3                  attempts in all, the first one included
+//	  statuses: [429, 502, 503, 504]
+//	  errors: true                 retry when no response is received
+//	  delay: 0.5                   seconds, doubled for every attempt
+//	  max: 30                      seconds of the longest wait
+//
+// Retry-After is honoured when a response has it, up to max. Attempts that
+// are retried are reported apart, and the request is counted once with its
+// last attempt.
+type Retry struct {
+	attempts int
+	statuses []int
+	errors   bool
+	delay    time.Duration
+	max      time.Duration
+}
+
+// NewRetry create a retry policy from its raw configuration value
+func NewRetry(rawValue interface{}) (*Retry, error) {
+	retry := &Retry{
+		statuses: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		errors:   true,
+		delay:    500 * time.Millisecond,
+		max:      30 * time.Second,
+	}
+	switch value := rawValue.(type) {
+	case int:
+		retry.attempts = value
+	case map[interface{}]interface{}:
+		for rawKey, rawValue := range value {
+			key := fmt.Sprintf("%v", rawKey)
+			switch key {
+			case "attempts":
+				attempts, ok := rawValue.(int)
+				if !ok {
+					return nil, fmt.Errorf("retry attempts must be a number")
+				}
+				retry.attempts = attempts
+			case "statuses":
+				retry.statuses = new(Cartridges).getCodes(rawValue)
+			case "errors":
+				errors, ok := rawValue.(bool)
+				if !ok {
+					return nil, fmt.Errorf("retry errors must be true or false")
+				}
+				retry.errors = errors
+			case "delay":
+				seconds, ok := toFloat(rawValue)
+				if !ok || seconds < 0 {
+					return nil, fmt.Errorf("retry delay must be a number of seconds")
+				}
+				retry.delay = toDuration(seconds)
+			case "max":
+				seconds, ok := toFloat(rawValue)
+				if !ok || seconds <= 0 {
+					return nil, fmt.Errorf("retry max must be a positive number of seconds")
+				}
+				retry.max = toDuration(seconds)
+			default:
+				return nil, fmt.Errorf("unknown retry option %s", key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("retry must be a number of attempts or a map")
+	}
+	if retry.attempts < 1 {
+		return nil, fmt.Errorf("retry attempts must be at least 1")
+	}
+	return retry, nil
+}
+
+// shouldRetry check whether an attempt is to be sent again
+func (r *Retry) shouldRetry(hit *Hit, attempt int) bool {
+	if attempt >= r.attempts {
+		return false
+	}
+	if hit.response == nil {
+		return r.errors
+	}
+	for _, status := range r.statuses {
+		if status == hit.response.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// getDelay get the wait before the attempt after the given one, at most max
+func (r *Retry) getDelay(hit *Hit, attempt int) time.Duration {
+	delay := r.delay * time.Duration(1<<uint(attempt-1))
+	if hit.response != nil {
+		if wait, ok := getRetryAfter(hit.response); ok {
+			delay = wait
+		}
+	}
+	if delay > r.max {
+		return r.max
+	}
+	return delay
+}
+
+// backOff set how long a killer waits before its next request after a
+// response, if at all
+func (k *Killer) backOff(response *http.Response) {
+	backoff := k.callCollection.Backoff
+	if backoff == nil || response == nil {
+		return
+	}
+	status := response.StatusCode
+	if backoff.respectRetryAfter && (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) {
+		if wait, ok := getRetryAfter(response); ok {
+			// A server asking for a day would otherwise park the user as long
+			if wait > backoff.max {
+				wait = backoff.max
+			}
+			k.backoffUntil = time.Now().Add(wait)
+			return
+		}
+	}
+	for _, backoffStatus := range backoff.statuses {
+		if backoffStatus == status {
+			k.backoffCount++
+			k.backoffUntil = time.Now().Add(backoff.getDelay(k.backoffCount))
+			return
+		}
+	}
+	k.backoffCount = 0
+}
+
+// waitBackoff wait until a killer may send again
+func (k *Killer) waitBackoff() {
+	if wait := time.Until(k.backoffUntil); wait > 0 {
+		k.run.log("backoff - %v", wait)
+		k.sleep(wait)
+	}
+}
+
+// getRetryAfter get the wait a response asks for in its Retry-After header,
+// given in seconds or as a date
+func getRetryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// toDuration get a duration from a number of seconds
+func toDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
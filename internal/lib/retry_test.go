@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	retry, err := NewRetry(map[interface{}]interface{}{"attempts": 3, "delay": 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unavailable := &Hit{response: &http.Response{StatusCode: 503, Header: http.Header{}}}
+	if !retry.shouldRetry(unavailable, 1) || !retry.shouldRetry(unavailable, 2) || retry.shouldRetry(unavailable, 3) {
+		t.Error("expected 503 to be retried up to 3 attempts")
+	}
+	if retry.shouldRetry(&Hit{response: &http.Response{StatusCode: 404}}, 1) {
+		t.Error("expected 404 not to be retried")
+	}
+	if !retry.shouldRetry(new(Hit), 1) {
+		t.Error("expected an attempt without a response to be retried")
+	}
+	if delay := retry.getDelay(unavailable, 2); delay != time.Second {
+		t.Errorf("got delay %v, want 1s", delay)
+	}
+	unavailable.response.Header.Set("Retry-After", "7")
+	if delay := retry.getDelay(unavailable, 2); delay != 7*time.Second {
+		t.Errorf("got delay %v, want Retry-After of 7s", delay)
+	}
+	unavailable.response.Header.Set("Retry-After", "86400")
+	if delay := retry.getDelay(unavailable, 2); delay != 30*time.Second {
+		t.Errorf("got delay %v, want Retry-After clamped to 30s", delay)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	backoff, err := NewBackoff(map[interface{}]interface{}{"initial": 1, "max": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	killer := &Killer{callCollection: &CallCollection{Backoff: backoff}}
+
+	unavailable := &http.Response{StatusCode: 503, Header: http.Header{}}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		killer.backOff(unavailable)
+		if wait := time.Until(killer.backoffUntil); wait > want || wait < want-time.Second/2 {
+			t.Errorf("response %d: got wait %v, want %v", i+1, wait, want)
+		}
+	}
+
+	limited := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"3"}}}
+	killer.backOff(limited)
+	if wait := time.Until(killer.backoffUntil); wait > 3*time.Second || wait < 2*time.Second {
+		t.Errorf("got wait %v, want Retry-After of 3s", wait)
+	}
+
+	limited.Header.Set("Retry-After", "86400")
+	killer.backOff(limited)
+	if wait := time.Until(killer.backoffUntil); wait > 5*time.Second || wait < 4*time.Second {
+		t.Errorf("got wait %v, want Retry-After clamped to max of 5s", wait)
+	}
+
+	killer.backOff(&http.Response{StatusCode: 200})
+	if killer.backoffCount != 0 {
+		t.Error("expected a success to reset the backoff")
+	}
+}
+
+func TestRespectRetryAfter(t *testing.T) {
+	run, err := NewRun([]byte(`
+host: localhost
+respect_retry_after: true
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	killer := &Killer{callCollection: run.collection}
+
+	killer.backOff(&http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"5"}}})
+	if wait := time.Until(killer.backoffUntil); wait > 5*time.Second || wait < 4*time.Second {
+		t.Errorf("got wait %v, want Retry-After of 5s", wait)
+	}
+
+	// Without Retry-After, nothing is backed off
+	killer.backoffUntil = time.Time{}
+	killer.backOff(&http.Response{StatusCode: 503, Header: http.Header{}})
+	if !killer.backoffUntil.IsZero() {
+		t.Error("expected no backoff without Retry-After")
+	}
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/ratelimit"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Run the state of a run of a configuration: its attack, target, requests,
+// report and rate limit. Runs share nothing, so that several can be made at
+// once in a process, such as in parallel tests.
+type Run struct {
+	attack     *Attack
+	target     *Target
+	collection *CallCollection
+	reporter   *Reporter
+	limiter    ratelimit.Limiter
+	// the path of the configuration, which relative paths in it are
+	// resolved against
+	configFile string
+	// the number of requests given an id so far
+	shotsCount int
+	// the number of virtual users running their script
+	activeVUs int32
+	// the statistics of the attack being run, for interim reports
+	statsMutex sync.Mutex
+	stats      *Stats
+	// a capacity search is run rather than an attack, which has no interim
+	// reports
+	capacitySearch bool
+	// the metrics served for Prometheus, if asked for
+	metrics       *Metrics
+	metricsServer *http.Server
+	metricsLinger time.Duration
+	// pushes results to the sinks of the reporter while the attack runs
+	pusher *pusher
+}
+
+// NewRun create a run from a configuration, as composed by LoadConfig, and
+// get it ready to start. file is the path of the configuration, or empty to
+// resolve relative paths in it against the working directory.
+func NewRun(data []byte, file string) (*Run, error) {
+	run := &Run{
+		attack: new(Attack),
+		target: NewTarget(),
+		collection: &CallCollection{
+			Features:   make(Features, 0),
+			Calibers:   make(CaliberMap),
+			Cartridges: make(Cartridges, 0),
+		},
+		reporter: new(Reporter),
+	}
+	if len(file) > 0 {
+		if absPath, err := filepath.Abs(file); err == nil {
+			file = absPath
+		}
+		run.configFile = file
+	}
+
+	// Settings for the overall test, the target, reporting, and the headers,
+	// params and requests
+	for _, value := range []interface{}{run.attack, run.target, run.reporter, run.collection} {
+		if err := yaml.Unmarshal(data, value); err != nil {
+			return nil, err
+		}
+	}
+	run.attack.run = run
+	run.attack.SetTarget(run.target)
+	run.attack.SetGun(run.collection)
+	run.collection.run = run
+	if err := run.attack.Prepare(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Attack get the attack of a run
+func (r *Run) Attack() *Attack {
+	return r.attack
+}
+
+// SetOutput set the file the report is written to, instead of the output
+// of the configuration
+func (r *Run) SetOutput(path string) {
+	r.reporter.Output = path
+}
+
+// SetStatsInterval set how often a line of statistics is printed while the
+// attack runs, instead of the interval of the configuration
+func (r *Run) SetStatsInterval(interval time.Duration) {
+	r.reporter.StatsInterval = interval.Seconds()
+}
+
+// SetDashboard show a full screen dashboard while the attack runs, or not,
+// instead of what the configuration says
+func (r *Run) SetDashboard(dashboard bool) {
+	r.reporter.Dashboard = dashboard
+}
+
+// ReportInterim print a report of the attack so far, without stopping it
+func (r *Run) ReportInterim() {
+	r.statsMutex.Lock()
+	stats, capacitySearch := r.stats, r.capacitySearch
+	r.statsMutex.Unlock()
+	if capacitySearch {
+		fmt.Println("No interim report during a capacity search, the steps are reported once it is over")
+		return
+	}
+	if stats == nil {
+		fmt.Println("No report yet, the attack has not started")
+		return
+	}
+	r.reporter.print(r.attack, stats, "Interim report, the attack goes on", false)
+}
+
+// setStats set the statistics of the attack being run
+func (r *Run) setStats(stats *Stats) {
+	r.statsMutex.Lock()
+	defer r.statsMutex.Unlock()
+	r.stats = stats
+}
+
+// setCapacitySearch mark the run as a capacity search
+func (r *Run) setCapacitySearch() {
+	r.statsMutex.Lock()
+	defer r.statsMutex.Unlock()
+	r.capacitySearch = true
+}
+
+// nextID get the id of a request, which its hits are reported by
+func (r *Run) nextID() int {
+	r.shotsCount++
+	return r.shotsCount
+}
+
+// log write a debug message, if the run is debugged
+func (r *Run) log(message string, args ...interface{}) {
+	if r != nil {
+		r.reporter.log(message, args...)
+	}
+}
+
+// ln write an empty debug line, if the run is debugged
+func (r *Run) ln() {
+	if r != nil {
+		r.reporter.ln()
+	}
+}
+
+// isDebug check whether requests and responses are dumped
+func (r *Run) isDebug() bool {
+	return r != nil && r.reporter.Debug
+}
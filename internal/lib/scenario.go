@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"go.uber.org/ratelimit"
+)
+
+// Scenario a script run by a share of the virtual users, to model a mix of
+// traffic in one run
+//
+//	scenarios:
+//	  browse:
+//	    weight: 70
+//	    requests:
+//	      - GET: /catalog
+//	  admin:
+//	    concurrency: 2
+//	    ratepersecond: 5
+//	    headers:
+//	      X-Role: admin
+//	    requests:
+//	      - GET: /admin/orders
+//
+// A scenario has its own requests, headers and params, and can set auth and
+// signing, taking from the top level those it does not set. Scenarios with a
+// concurrency get that many virtual users, the others share the top level
+// concurrency in proportion to their weights (default 1), each needing at
+// least one virtual user. A scenario with a ratepersecond is limited on its
+// own rather than by the top level rate.
+type Scenario struct {
+	name           string
+	callCollection *CallCollection
+	Weight         float64 `yaml:"weight"`
+	Concurrency    int     `yaml:"concurrency"`
+	Rate           int     `yaml:"ratepersecond"`
+	vus            int
+	limiter        ratelimit.Limiter
+}
+
+type Scenarios map[string]*Scenario
+
+func (s *Scenario) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	s.callCollection = &CallCollection{
+		Features:   make(Features, 0),
+		Calibers:   make(CaliberMap),
+		Cartridges: make(Cartridges, 0),
+	}
+	if err := unmarshal(s.callCollection); err != nil {
+		return err
+	}
+	settings := struct {
+		Weight      float64 `yaml:"weight"`
+		Concurrency int     `yaml:"concurrency"`
+		Rate        int     `yaml:"ratepersecond"`
+	}{}
+	if err := unmarshal(&settings); err != nil {
+		return err
+	}
+	if settings.Weight < 0 || settings.Concurrency < 0 || settings.Rate < 0 {
+		return fmt.Errorf("scenario weight, concurrency and ratepersecond must be positive")
+	}
+	s.Weight = settings.Weight
+	s.Concurrency = settings.Concurrency
+	s.Rate = settings.Rate
+	return nil
+}
+
+func (s *Scenario) getWeight() float64 {
+	if s.Weight > 0 {
+		return s.Weight
+	}
+	return 1
+}
+
+// getScenarios get the scenarios of a collection sorted by name, or a single
+// unnamed scenario running the top level requests
+func (cc *CallCollection) getScenarios() []*Scenario {
+	if len(cc.Scenarios) == 0 {
+		return []*Scenario{{callCollection: cc}}
+	}
+	names := make([]string, 0, len(cc.Scenarios))
+	for name := range cc.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	scenarios := make([]*Scenario, 0, len(names))
+	for _, name := range names {
+		scenario := cc.Scenarios[name]
+		scenario.name = name
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios
+}
+
+// inherit take the headers, params, auth, signing, vu_setup, pacing and backoff
+// of the top level that a scenario does not set itself
+func (cc *CallCollection) inherit(parent *CallCollection) {
+	cc.run = parent.run
+	// The scenario's own headers are set after the top level ones, so they win
+	features := make(Features, 0, len(parent.Features)+len(cc.Features))
+	features = append(features, parent.Features...)
+	cc.Features = append(features, cc.Features...)
+	if cc.Calibers == nil {
+		cc.Calibers = make(CaliberMap)
+	}
+	for key, caliber := range parent.Calibers {
+		if _, ok := cc.Calibers[key]; !ok {
+			cc.Calibers[key] = caliber
+		}
+	}
+	if cc.Auth == nil {
+		cc.Auth = parent.Auth
+	}
+	if cc.Signing == nil {
+		cc.Signing = parent.Signing
+	}
+	if len(cc.VUSetup) == 0 {
+		cc.VUSetup = parent.VUSetup
+	}
+	if cc.Pacing == 0 {
+		cc.Pacing = parent.Pacing
+	}
+	if cc.Backoff == nil && !cc.RespectRetryAfter {
+		cc.Backoff = parent.Backoff
+	}
+}
+
+// shareVirtualUsers give every scenario its number of virtual users, those
+// without a concurrency of their own sharing concurrency by weight. A scenario
+// whose share is too small to get a virtual user is an error, as it would
+// never run.
+func shareVirtualUsers(scenarios []*Scenario, concurrency int) error {
+	totalWeight := 0.0
+	for _, scenario := range scenarios {
+		if scenario.Concurrency == 0 {
+			totalWeight += scenario.getWeight()
+		}
+	}
+
+	// Largest remainders, so that the shares add up to the concurrency
+	shared := 0
+	remainders := make([]*Scenario, 0, len(scenarios))
+	fractions := make(map[*Scenario]float64)
+	for _, scenario := range scenarios {
+		if scenario.Concurrency > 0 {
+			scenario.vus = scenario.Concurrency
+			continue
+		}
+		share := float64(concurrency) * scenario.getWeight() / totalWeight
+		scenario.vus = int(math.Floor(share))
+		shared += scenario.vus
+		fractions[scenario] = share - math.Floor(share)
+		remainders = append(remainders, scenario)
+	}
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return fractions[remainders[i]] > fractions[remainders[j]]
+	})
+	for i := 0; shared < concurrency && i < len(remainders); i++ {
+		remainders[i].vus++
+		shared++
+	}
+	for _, scenario := range scenarios {
+		if scenario.vus == 0 {
+			return fmt.Errorf(
+				"scenario %s gets no virtual users out of a concurrency of %d, raise concurrency or give the scenario a concurrency of its own",
+				scenario.name,
+				concurrency,
+			)
+		}
+	}
+	return nil
+}
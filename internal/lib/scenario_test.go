@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestScenarios(t *testing.T) {
+	collection := &CallCollection{run: &Run{reporter: new(Reporter)}, Calibers: make(CaliberMap)}
+	err := yaml.Unmarshal([]byte(`
+headers:
+  X-Global: global
+params:
+  who: global
+scenarios:
+  browse:
+    weight: 70
+    requests:
+      - GET: /catalog?who=${who}
+  user:
+    weight: 25
+    params:
+      who: user
+    requests:
+      - GET: /profile?who=${who}
+  admin:
+    weight: 5
+    concurrency: 2
+    requests:
+      - GET: /admin
+`), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := collection.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := collection.getScenarios()
+	if err := shareVirtualUsers(scenarios, 10); err != nil {
+		t.Fatal(err)
+	}
+	vus := make(map[string]int)
+	for _, scenario := range scenarios {
+		vus[scenario.name] = scenario.vus
+	}
+	if vus["admin"] != 2 || vus["browse"] != 7 || vus["user"] != 3 {
+		t.Errorf("got virtual users %v", vus)
+	}
+
+	for name, want := range map[string]string{"browse": "/catalog?who=global", "user": "/profile?who=user"} {
+		scenario := collection.Scenarios[name]
+		killer := new(Killer)
+		killer.setGun(scenario.callCollection)
+		if path := scenario.callCollection.Cartridges[0].getPathAsString(killer); path != want {
+			t.Errorf("got %s path %s, want %s", name, path, want)
+		}
+		if len(scenario.callCollection.Features) != 1 {
+			t.Errorf("expected %s to inherit the global header", name)
+		}
+	}
+}
+
+func TestScenariosWithoutVirtualUsers(t *testing.T) {
+	config := `
+host: localhost
+scenarios:
+  browse:
+    weight: 9
+    requests:
+      - GET: /catalog
+  admin:
+    requests:
+      - GET: /admin
+`
+	// The default concurrency of 1 leaves admin without a virtual user
+	if _, err := NewRun([]byte(config), ""); err == nil || !strings.Contains(err.Error(), "scenario admin gets no virtual users") {
+		t.Errorf("got error %v, want admin to get no virtual users", err)
+	}
+	if _, err := NewRun([]byte("concurrency: 10\n"+config), ""); err != nil {
+		t.Errorf("got error %v with a virtual user each", err)
+	}
+}
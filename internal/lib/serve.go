@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SERVE_ADDRESS the address the mock server listens on by default
+const SERVE_ADDRESS = "127.0.0.1:8080"
+
+// demoRoutes the routes of the mock server when no file is given, enough to
+// try out sessions, extraction, retries and the reports
+const demoRoutes = `
+routes:
+  - path: /
+    body: mgun mock server
+  - path: /items
+    body: '{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}'
+    headers:
+      Content-Type: application/json
+  - path: /items/*
+    latency: {uniform: [0.01, 0.05]}
+    body: '{"id": 1, "name": "item"}'
+    headers:
+      Content-Type: application/json
+  - path: /login
+    method: POST
+    body: '{"token": "demo"}'
+    headers:
+      Content-Type: application/json
+    cookies:
+      session: demo
+  - path: /slow
+    latency: {normal: [0.2, 0.05], max: 1}
+  - path: /flaky
+    error_rate: 10
+    error_status: 503
+  - path: /large
+    size: 1048576
+  - path: /echo
+    echo: true
+`
+
+// Server a local HTTP server to point mgun at, for demos and tests
+//
+//	listen: 127.0.0.1:8080
+//	routes:
+//	  - path: /items           exact, or a prefix ending in *
+//	    method: GET            any when left out
+//	    status: 200
+//	    latency: {normal: [0.05, 0.01]}  seconds, as for think
+//	    error_rate: 5          percent of responses with error_status
+//	    error_status: 503
+//	    size: 1024             bytes of a generated body
+//	    body: '{"id": 1}'      or a body given as is
+//	    headers:
+//	      Content-Type: application/json
+//	    cookies:
+//	      session: abc         set with Set-Cookie
+//	    echo: true             answer with the request as JSON
+//
+// Routes are matched in order, and other requests get a 404.
+type Server struct {
+	Listen string   `yaml:"listen"`
+	Routes []*Route `yaml:"routes"`
+	mutex  sync.Mutex
+	rand   *rand.Rand
+}
+
+// Route a route of the mock server
+type Route struct {
+	Path        string            `yaml:"path"`
+	Method      string            `yaml:"method"`
+	Status      int               `yaml:"status"`
+	Latency     *Think            `yaml:"latency"`
+	ErrorRate   float64           `yaml:"error_rate"`
+	ErrorStatus int               `yaml:"error_status"`
+	Size        int               `yaml:"size"`
+	Body        string            `yaml:"body"`
+	Headers     map[string]string `yaml:"headers"`
+	Cookies     map[string]string `yaml:"cookies"`
+	Echo        bool              `yaml:"echo"`
+}
+
+// echo the request as an echo route answers it
+type echo struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+}
+
+// NewServer create a mock server from a routes file, or with the demo routes
+// when there is none
+func NewServer(file string) (*Server, error) {
+	data := []byte(demoRoutes)
+	if len(file) > 0 {
+		var err error
+		data, err = ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	server := new(Server)
+	if err := yaml.Unmarshal(data, server); err != nil {
+		return nil, err
+	}
+	if err := server.prepare(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// prepare check the routes and set their defaults
+func (s *Server) prepare() error {
+	if len(s.Listen) == 0 {
+		s.Listen = SERVE_ADDRESS
+	}
+	if len(s.Routes) == 0 {
+		return fmt.Errorf("the mock server needs routes")
+	}
+	for i, route := range s.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("route %d: path must start with /", i+1)
+		}
+		if route.ErrorRate < 0 || route.ErrorRate > 100 {
+			return fmt.Errorf("route %s: error_rate must be between 0 and 100", route.Path)
+		}
+		if route.Size < 0 {
+			return fmt.Errorf("route %s: size must not be negative", route.Path)
+		}
+		route.Method = strings.ToUpper(route.Method)
+		if route.Status == 0 {
+			route.Status = http.StatusOK
+		}
+		if route.ErrorStatus == 0 {
+			route.ErrorStatus = http.StatusInternalServerError
+		}
+	}
+	s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	return nil
+}
+
+// ListenAndServe serve the routes until the server fails
+func (s *Server) ListenAndServe() error {
+	fmt.Printf("Serving on http://%s\n", s.Listen)
+	for _, route := range s.Routes {
+		method := route.Method
+		if len(method) == 0 {
+			method = "*"
+		}
+		fmt.Printf("  %-6s %s\n", method, route.Path)
+	}
+	return http.ListenAndServe(s.Listen, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := s.findRoute(r)
+	if route == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Draw under the lock, as requests are served concurrently
+	s.mutex.Lock()
+	var latency time.Duration
+	if route.Latency != nil {
+		latency = route.Latency.duration(s.rand)
+	}
+	failed := route.ErrorRate > 0 && s.rand.Float64()*100 < route.ErrorRate
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failed {
+		http.Error(w, http.StatusText(route.ErrorStatus), route.ErrorStatus)
+		return
+	}
+
+	for name, value := range route.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, value := range route.Cookies {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	switch {
+	case route.Echo:
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(route.Status)
+		json.NewEncoder(w).Encode(echo{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   r.URL.Query(),
+			Headers: r.Header,
+			Body:    string(body),
+		})
+	case route.Size > 0:
+		w.WriteHeader(route.Status)
+		w.Write([]byte(strings.Repeat("x", route.Size)))
+	default:
+		w.WriteHeader(route.Status)
+		w.Write([]byte(route.Body))
+	}
+}
+
+// findRoute find the first route that matches a request
+func (s *Server) findRoute(r *http.Request) *Route {
+	for _, route := range s.Routes {
+		if len(route.Method) > 0 && route.Method != r.Method {
+			continue
+		}
+		if prefix := strings.TrimSuffix(route.Path, "*"); prefix != route.Path {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return route
+			}
+		} else if route.Path == r.URL.Path {
+			return route
+		}
+	}
+	return nil
+}
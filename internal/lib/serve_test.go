@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestServer(t *testing.T) {
+	server := new(Server)
+	err := yaml.Unmarshal([]byte(`
+routes:
+  - path: /down
+    error_rate: 100
+    error_status: 503
+  - path: /users/*
+    method: get
+    status: 201
+    body: user
+    cookies:
+      session: abc
+  - path: /blob
+    size: 10
+`), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/down", 503, "Service Unavailable\n"},
+		{"GET", "/users/1", 201, "user"},
+		{"POST", "/users/1", 404, "404 page not found\n"},
+		{"GET", "/blob", 200, "xxxxxxxxxx"},
+		{"GET", "/other", 404, "404 page not found\n"},
+	}
+	for _, check := range checks {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(check.method, check.path, nil))
+		if recorder.Code != check.status || recorder.Body.String() != check.body {
+			t.Errorf("%s %s: got %d %q, want %d %q", check.method, check.path, recorder.Code, recorder.Body.String(), check.status, check.body)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/2", nil))
+	if cookie := recorder.Header().Get("Set-Cookie"); !strings.HasPrefix(cookie, "session=abc") {
+		t.Errorf("got Set-Cookie %q, want session=abc", cookie)
+	}
+
+	if _, err := NewServer(""); err != nil {
+		t.Errorf("demo routes: %v", err)
+	}
+}
+
+// TestServeAttack run virtual users against the demo routes of the mock
+// server, checking what they sent to its echo route
+func TestServeAttack(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hits do not keep response bodies, so what was sent is recorded here
+	var mutex sync.Mutex
+	echoes := make([]string, 0)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/echo" {
+			mutex.Lock()
+			echoes = append(echoes, r.URL.Query().Get("token")+" "+r.Header.Get("Cookie"))
+			mutex.Unlock()
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer mock.Close()
+
+	script := []byte(`
+base_url: ` + mock.URL + `
+concurrency: 2
+loopcount: 3
+requests:
+  - POST: /login
+    extract:
+      token: {json: token}
+  - GET: /items
+    extract:
+      ids: {json: items.*.id}
+  - FOREACH: ids
+    do:
+      - GET: /items/${item}
+  - GET: /echo?token=${token}
+`)
+	run, err := NewRun(script, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attack := run.Attack()
+	attack.setRateLimit()
+	paths := make(map[string]int)
+	attack.launch(context.Background(), attack.AttemptsCount, false, func(hits <-chan *Hit) {
+		for hit := range hits {
+			if !hit.isSuccess() {
+				t.Errorf("%s failed", hit.shot.request.URL)
+				continue
+			}
+			paths[hit.shot.request.URL.Path]++
+		}
+	})
+
+	for _, path := range []string{"/login", "/items", "/items/1", "/items/2", "/items/3", "/echo"} {
+		if paths[path] != 6 {
+			t.Errorf("%s: got %d requests, want 6", path, paths[path])
+		}
+	}
+	for _, echo := range echoes {
+		if !strings.HasPrefix(echo, "demo ") || !strings.Contains(echo, "session=demo") {
+			t.Errorf("expected the token and the session cookie to be sent, got %s", echo)
+		}
+	}
+}
+
+func TestServeAttackStopped(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := httptest.NewServer(server)
+	defer mock.Close()
+
+	script := []byte(`
+base_url: ` + mock.URL + `
+concurrency: 2
+loopcount: 1000
+requests:
+  - GET: /slow
+teardown:
+  - GET: /items
+`)
+	run, err := NewRun(script, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attack := run.Attack()
+	attack.setRateLimit()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	paths := make(map[string]int)
+	started := time.Now()
+	attack.launch(ctx, attack.AttemptsCount, false, func(hits <-chan *Hit) {
+		for hit := range hits {
+			// requests in flight when the run was stopped finish
+			if !hit.isSuccess() {
+				t.Errorf("%s failed", hit.shot.request.URL)
+			}
+			paths[hit.shot.request.URL.Path]++
+		}
+	})
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("got a run of %v, want it stopped after about 300ms", elapsed)
+	}
+	if paths["/slow"] == 0 || paths["/slow"] > 20 {
+		t.Errorf("got %d requests to /slow, want a few", paths["/slow"])
+	}
+	if paths["/items"] != 1 {
+		t.Errorf("expected the teardown to run once, got %d", paths["/items"])
+	}
+}
+
+func TestServeSetupStopped(t *testing.T) {
+	server, err := NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := httptest.NewServer(server)
+	defer mock.Close()
+
+	script := []byte(`
+base_url: ` + mock.URL + `
+concurrency: 2
+setup:
+  - REPEAT: {times: 100}
+    do:
+      - GET: /slow
+requests:
+  - GET: /items
+teardown:
+  - GET: /items
+`)
+	run, err := NewRun(script, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attack := run.Attack()
+	attack.setRateLimit()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	phases := make(map[string]int)
+	started := time.Now()
+	attack.launch(ctx, attack.AttemptsCount, false, func(hits <-chan *Hit) {
+		for hit := range hits {
+			phases[hit.shot.cartridge.phase]++
+		}
+	})
+
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("got a run of %v, want setup stopped after about 300ms", elapsed)
+	}
+	if phases[PHASE_SETUP] == 0 || phases[PHASE_SETUP] > 20 {
+		t.Errorf("got %d setup requests, want a few", phases[PHASE_SETUP])
+	}
+	if phases[""] != 0 {
+		t.Errorf("got %d requests of the load, want none after an interrupted setup", phases[""])
+	}
+	if phases[PHASE_TEARDOWN] != 1 {
+		t.Errorf("expected the teardown to run once, got %d", phases[PHASE_TEARDOWN])
+	}
+}
@@ -0,0 +1,335 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SIGNING_TYPE_NONE  = "none"
+	SIGNING_TYPE_HMAC  = "hmac"
+	SIGNING_TYPE_SIGV4 = "sigv4"
+
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat  = "20060102T150405Z"
+	sigV4DateFormat  = "20060102"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Signing a signature computed over the fully built request just before it is
+// sent, given with the signing key globally or for a single request.
+//
+// The hmac type signs the string
+//
+//	METHOD\nREQUEST_URI\nTIMESTAMP\nHEX(SHA256(BODY))
+//
+// with key and puts the signature in header (default X-Signature) and the unix
+// timestamp in timestamp_header (default X-Timestamp). algorithm is sha256
+// (default), sha1 or sha512, encoding is hex (default) or base64.
+//
+// The sigv4 type signs the request the way AWS API gateways expect, using
+// access_key, secret_key, an optional session_token, region and service.
+//
+// Streamed multipart uploads are signed with an UNSIGNED-PAYLOAD body hash.
+type Signing struct {
+	kind            string
+	key             *Feature
+	header          string
+	timestampHeader string
+	algorithm       string
+	encoding        string
+	accessKey       *Feature
+	secretKey       *Feature
+	sessionToken    *Feature
+	region          string
+	service         string
+}
+
+func (s *Signing) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	var rawSigning interface{}
+	if err := unmarshal(&rawSigning); err != nil {
+		return err
+	}
+	signing, err := NewSigning(rawSigning)
+	if err != nil {
+		return err
+	}
+	*s = *signing
+	return nil
+}
+
+// NewSigning create request signing from its raw configuration value
+func NewSigning(rawSigning interface{}) (*Signing, error) {
+	signing := new(Signing)
+	if kind, ok := rawSigning.(string); ok && kind == SIGNING_TYPE_NONE {
+		signing.kind = SIGNING_TYPE_NONE
+		return signing, nil
+	}
+	rawMap, ok := rawSigning.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid signing %v", rawSigning)
+	}
+	value := func(key string) *Feature {
+		if rawValue, ok := rawMap[key]; ok {
+			return NewDescribedFeature(fmt.Sprintf("%v", rawValue))
+		}
+		return nil
+	}
+	text := func(key, defaultValue string) string {
+		if rawValue, ok := rawMap[key]; ok {
+			return fmt.Sprintf("%v", rawValue)
+		}
+		return defaultValue
+	}
+
+	signing.kind = text("type", "")
+	switch signing.kind {
+	case SIGNING_TYPE_NONE:
+	case SIGNING_TYPE_HMAC:
+		signing.key = value("key")
+		signing.header = text("header", "X-Signature")
+		signing.timestampHeader = text("timestamp_header", "X-Timestamp")
+		signing.algorithm = text("algorithm", "sha256")
+		signing.encoding = text("encoding", "hex")
+		if signing.key == nil {
+			return nil, fmt.Errorf("hmac signing needs a key")
+		}
+		if signing.hash() == nil {
+			return nil, fmt.Errorf("unsupported hmac algorithm %s", signing.algorithm)
+		}
+		if signing.encoding != "hex" && signing.encoding != "base64" {
+			return nil, fmt.Errorf("unsupported hmac encoding %s", signing.encoding)
+		}
+	case SIGNING_TYPE_SIGV4:
+		signing.accessKey = value("access_key")
+		signing.secretKey = value("secret_key")
+		signing.sessionToken = value("session_token")
+		signing.region = text("region", "us-east-1")
+		signing.service = text("service", "execute-api")
+		if signing.accessKey == nil || signing.secretKey == nil {
+			return nil, fmt.Errorf("sigv4 signing needs an access_key and secret_key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing type %s", signing.kind)
+	}
+	return signing, nil
+}
+
+func (s *Signing) hash() func() hash.Hash {
+	switch s.algorithm {
+	case "sha1":
+		return sha1.New
+	case "sha256":
+		return sha256.New
+	case "sha512":
+		return sha512.New
+	}
+	return nil
+}
+
+// sign add signature headers to a request
+func (k *Killer) sign(request *http.Request, signing *Signing) error {
+	switch signing.kind {
+	case SIGNING_TYPE_HMAC:
+		return k.signHMAC(request, signing, time.Now())
+	case SIGNING_TYPE_SIGV4:
+		return k.signV4(request, signing, time.Now())
+	}
+	return nil
+}
+
+func (k *Killer) signHMAC(request *http.Request, signing *Signing, now time.Time) error {
+	payloadHash, err := getPayloadHash(request)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stringToSign := strings.Join([]string{
+		request.Method,
+		request.URL.RequestURI(),
+		timestamp,
+		payloadHash,
+	}, "\n")
+
+	mac := hmac.New(signing.hash(), []byte(signing.key.String(k)))
+	mac.Write([]byte(stringToSign))
+	var signature string
+	if signing.encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	} else {
+		signature = hex.EncodeToString(mac.Sum(nil))
+	}
+	request.Header.Set(signing.header, signature)
+	request.Header.Set(signing.timestampHeader, timestamp)
+	return nil
+}
+
+func (k *Killer) signV4(request *http.Request, signing *Signing, now time.Time) error {
+	payloadHash, err := getPayloadHash(request)
+	if err != nil {
+		return err
+	}
+	now = now.UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := now.Format(sigV4DateFormat)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	if signing.sessionToken != nil {
+		request.Header.Set("X-Amz-Security-Token", signing.sessionToken.String(k))
+	}
+	if signing.service == "s3" {
+		request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := request.Host
+	if len(host) == 0 {
+		host = request.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		getSigV4Path(request.URL, signing.service != "s3"),
+		getSigV4Query(request.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, signing.region, signing.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+signing.secretKey.String(k)), date)
+	signingKey = hmacSHA256(signingKey, signing.region)
+	signingKey = hmacSHA256(signingKey, signing.service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm,
+		signing.accessKey.String(k),
+		scope,
+		signedHeaders,
+		signature,
+	))
+	return nil
+}
+
+// getPayloadHash get the hex SHA256 of a request body without consuming it
+func getPayloadHash(request *http.Request) (string, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return emptyPayloadHash, nil
+	}
+	if request.GetBody == nil {
+		// streamed bodies can not be read twice
+		return unsignedPayload, nil
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return hexSHA256(data), nil
+}
+
+func getSigV4Path(u *url.URL, encodeTwice bool) string {
+	path := u.EscapedPath()
+	if len(path) == 0 {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = uriEncode(unescaped)
+		if encodeTwice {
+			segments[i] = uriEncode(segments[i])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func getSigV4Query(u *url.URL) string {
+	query := u.Query()
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent encode everything but RFC 3986 unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newTestSigning(t *testing.T, config string) *Signing {
+	signing := new(Signing)
+	if err := yaml.Unmarshal([]byte(config), signing); err != nil {
+		t.Fatal(err)
+	}
+	return signing
+}
+
+// TestSignV4 check against the get-vanilla case of the AWS SigV4 test suite
+func TestSignV4(t *testing.T) {
+	signing := newTestSigning(t, `
+type: sigv4
+access_key: AKIDEXAMPLE
+secret_key: wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY
+region: us-east-1
+service: service
+`)
+	request, _ := http.NewRequest(GET_METHOD, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	if err := new(Killer).signV4(request, signing, now); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := request.Header.Get("Authorization"); got != want {
+		t.Errorf("got authorization\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+	signing := newTestSigning(t, "{type: hmac, key: secret}")
+	body := []byte(`{"a":1}`)
+	request, _ := http.NewRequest(POST_METHOD, "http://example.com/orders?id=1", bytes.NewReader(body))
+	now := time.Unix(1600000000, 0)
+	if err := new(Killer).signHMAC(request, signing, now); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("POST\n/orders?id=1\n1600000000\n" + hex.EncodeToString(sum[:])))
+	if got, want := request.Header.Get("X-Signature"), hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("got signature %s, want %s", got, want)
+	}
+	if got := request.Header.Get("X-Timestamp"); got != "1600000000" {
+		t.Errorf("got timestamp %s", got)
+	}
+	// the body must still be there to be sent
+	if sent, _ := ioutil.ReadAll(request.Body); !bytes.Equal(sent, body) {
+		t.Errorf("got body %s after signing", sent)
+	}
+}
@@ -0,0 +1,393 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SINK_INFLUXDB = "influxdb"
+	SINK_STATSD   = "statsd"
+	SINK_GRAPHITE = "graphite"
+	// SINK_PREFIX the measurement or the prefix of the metric names, unless
+	// a sink has its own
+	SINK_PREFIX = "mgun"
+	// SINK_PACKET_SIZE bytes of lines sent at most in a UDP packet
+	SINK_PACKET_SIZE = 1400
+)
+
+// Sink a metrics system that aggregated results are pushed to while the
+// attack runs: InfluxDB over HTTP or UDP, StatsD over UDP or Graphite over TCP
+type Sink struct {
+	Type string `yaml:"type"`
+	// the write url of InfluxDB over HTTP, such as
+	// http://localhost:8086/write?db=mgun
+	URL string `yaml:"url"`
+	// host:port of InfluxDB over UDP, StatsD or Graphite
+	Address string `yaml:"address"`
+	// sent as Authorization: Token to InfluxDB over HTTP
+	Token  string            `yaml:"token"`
+	Prefix string            `yaml:"prefix"`
+	Tags   map[string]string `yaml:"tags"`
+	// seconds the results are aggregated over, 1 by default
+	Interval float64 `yaml:"interval"`
+	client   *http.Client
+	conn     net.Conn
+	// the first error is printed, not the ones that follow
+	failed bool
+}
+
+// sinkPoint the results of a request over an interval
+type sinkPoint struct {
+	request   string
+	method    string
+	requests  int64
+	errors    int64
+	bytes     int64
+	durations *Histogram
+}
+
+// prepare check the settings of a sink and set its defaults
+func (s *Sink) prepare() error {
+	switch s.Type {
+	case SINK_INFLUXDB:
+		if len(s.URL) == 0 && len(s.Address) == 0 {
+			return fmt.Errorf("influxdb sink needs a url for HTTP or an address for UDP")
+		}
+		if len(s.URL) > 0 {
+			if _, err := url.Parse(s.URL); err != nil {
+				return fmt.Errorf("influxdb sink url: %v", err)
+			}
+			s.client = &http.Client{Timeout: 5 * time.Second}
+		}
+	case SINK_STATSD, SINK_GRAPHITE:
+		if len(s.Address) == 0 {
+			return fmt.Errorf("%s sink needs an address", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q, use influxdb, statsd or graphite", s.Type)
+	}
+	if len(s.Prefix) == 0 {
+		s.Prefix = SINK_PREFIX
+	}
+	if s.Interval <= 0 {
+		s.Interval = 1
+	}
+	return nil
+}
+
+// getInterval get how often results are pushed to a sink
+func (s *Sink) getInterval() time.Duration {
+	return time.Duration(s.Interval * float64(time.Second))
+}
+
+// push send the results of an interval to a sink, printing the first error
+func (s *Sink) push(points []*sinkPoint, activeVUs int, virtualUsers int, at time.Time) {
+	lines := s.format(points, activeVUs, virtualUsers, at)
+	if err := s.send(lines); err != nil && !s.failed {
+		s.failed = true
+		fmt.Printf("Problem pushing metrics to %s, %v\n", s.Type, err)
+	}
+}
+
+// format get the lines of the results of an interval in the protocol of a
+// sink
+func (s *Sink) format(points []*sinkPoint, activeVUs int, virtualUsers int, at time.Time) []string {
+	lines := make([]string, 0)
+	for _, point := range points {
+		tags := s.getTags(point.request, point.method)
+		milliseconds := func(duration time.Duration) float64 {
+			return float64(duration) / float64(time.Millisecond)
+		}
+		counters := []sinkValue{
+			{"requests", float64(point.requests)},
+			{"errors", float64(point.errors)},
+			{"bytes", float64(point.bytes)},
+		}
+		gauges := []sinkValue{
+			{"mean", milliseconds(point.durations.mean())},
+			{"p50", milliseconds(point.durations.percentile(50))},
+			{"p95", milliseconds(point.durations.percentile(95))},
+			{"p99", milliseconds(point.durations.percentile(99))},
+			{"max", milliseconds(point.durations.max)},
+		}
+		lines = append(lines, s.formatValues(tags, counters, gauges, at)...)
+	}
+	vus := []sinkValue{{"active_vus", float64(activeVUs)}, {"vus", float64(virtualUsers)}}
+	return append(lines, s.formatValues(s.getTags("", ""), nil, vus, at)...)
+}
+
+// sinkValue a named value of a point
+type sinkValue struct {
+	name  string
+	value float64
+}
+
+// formatValues get the lines of counters and gauges with the same tags
+func (s *Sink) formatValues(tags [][2]string, counters []sinkValue, gauges []sinkValue, at time.Time) []string {
+	lines := make([]string, 0)
+	switch s.Type {
+	case SINK_INFLUXDB:
+		// One line per point, counters as integers
+		var b strings.Builder
+		b.WriteString(escapeInflux(s.Prefix, ", "))
+		for _, tag := range tags {
+			fmt.Fprintf(&b, ",%s=%s", escapeInflux(tag[0], ",= "), escapeInflux(tag[1], ",= "))
+		}
+		fields := make([]string, 0, len(counters)+len(gauges))
+		for _, counter := range counters {
+			fields = append(fields, fmt.Sprintf("%s=%di", counter.name, int64(counter.value)))
+		}
+		for _, gauge := range gauges {
+			fields = append(fields, fmt.Sprintf("%s=%s", gauge.name, formatFloat(gauge.value)))
+		}
+		fmt.Fprintf(&b, " %s %d", strings.Join(fields, ","), at.UnixNano())
+		lines = append(lines, b.String())
+	case SINK_STATSD:
+		// Tags as DogStatsD does, which Telegraf and Datadog read
+		suffix := ""
+		if len(tags) > 0 {
+			pairs := make([]string, 0, len(tags))
+			for _, tag := range tags {
+				pairs = append(pairs, cleanTag(tag[0], ",|#:")+":"+cleanTag(tag[1], ",|#"))
+			}
+			suffix = "|#" + strings.Join(pairs, ",")
+		}
+		for _, counter := range counters {
+			lines = append(lines, fmt.Sprintf("%s.%s:%d|c%s", s.Prefix, counter.name, int64(counter.value), suffix))
+		}
+		for _, gauge := range gauges {
+			lines = append(lines, fmt.Sprintf("%s.%s:%s|g%s", s.Prefix, gauge.name, formatFloat(gauge.value), suffix))
+		}
+	case SINK_GRAPHITE:
+		// Tags as Graphite 1.1 takes them, name;tag=value
+		suffix := ""
+		for _, tag := range tags {
+			suffix += ";" + cleanTag(tag[0], ";!^=~ ") + "=" + cleanTag(tag[1], ";~ ")
+		}
+		for _, value := range append(counters, gauges...) {
+			lines = append(lines, fmt.Sprintf("%s.%s%s %s %d", s.Prefix, value.name, suffix, formatFloat(value.value), at.Unix()))
+		}
+	}
+	return lines
+}
+
+// getTags get the tags of a point, those of the sink first in name order and
+// then the request and method if there is one
+func (s *Sink) getTags(request string, method string) [][2]string {
+	names := make([]string, 0, len(s.Tags))
+	for name := range s.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tags := make([][2]string, 0, len(names)+2)
+	for _, name := range names {
+		tags = append(tags, [2]string{name, s.Tags[name]})
+	}
+	if len(request) > 0 {
+		tags = append(tags, [2]string{"request", request}, [2]string{"method", method})
+	}
+	return tags
+}
+
+// send send lines to a sink
+func (s *Sink) send(lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	if s.client != nil {
+		request, err := http.NewRequest(POST_METHOD, s.URL, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+		if err != nil {
+			return err
+		}
+		if len(s.Token) > 0 {
+			request.Header.Set("Authorization", "Token "+s.Token)
+		}
+		resp, err := s.client.Do(request)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}
+
+	network := "udp"
+	if s.Type == SINK_GRAPHITE {
+		network = "tcp"
+	}
+	if s.conn == nil {
+		conn, err := net.DialTimeout(network, s.Address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	packets := make([][]byte, 0)
+	if network == "tcp" {
+		packets = append(packets, []byte(strings.Join(lines, "\n")+"\n"))
+	} else {
+		// Lines are packed into datagrams small enough not to be fragmented
+		var packet bytes.Buffer
+		for _, line := range lines {
+			if packet.Len() > 0 && packet.Len()+len(line)+1 > SINK_PACKET_SIZE {
+				packets = append(packets, append([]byte(nil), packet.Bytes()...))
+				packet.Reset()
+			}
+			packet.WriteString(line)
+			packet.WriteString("\n")
+		}
+		packets = append(packets, packet.Bytes())
+	}
+	for _, packet := range packets {
+		if _, err := s.conn.Write(packet); err != nil {
+			// Dialled again on the next push, such as after Graphite restarted
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// close close the connection of a sink
+func (s *Sink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// escapeInflux escape characters of the InfluxDB line protocol
+func escapeInflux(value string, characters string) string {
+	for _, character := range characters {
+		value = strings.ReplaceAll(value, string(character), `\`+string(character))
+	}
+	return value
+}
+
+// cleanTag replace characters a protocol does not allow in tags
+func cleanTag(value string, characters string) string {
+	for _, character := range characters {
+		value = strings.ReplaceAll(value, string(character), "_")
+	}
+	return value
+}
+
+// formatFloat format a value without a needless exponent or zeros
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// pusher aggregate hits per request over the interval of every sink and push
+// the results while the attack runs
+type pusher struct {
+	run   *Run
+	sinks []*pushedSink
+	done  chan struct{}
+	group sync.WaitGroup
+}
+
+// pushedSink a sink and the results of its current interval
+type pushedSink struct {
+	mutex  sync.Mutex
+	sink   *Sink
+	points map[metricKey]*sinkPoint
+}
+
+// startPush start pushing results to the sinks of the run, if it has any
+func (r *Run) startPush() *pusher {
+	if len(r.reporter.Sinks) == 0 {
+		return nil
+	}
+	p := &pusher{run: r, done: make(chan struct{})}
+	for _, sink := range r.reporter.Sinks {
+		pushed := &pushedSink{sink: sink, points: make(map[metricKey]*sinkPoint)}
+		p.sinks = append(p.sinks, pushed)
+		p.group.Add(1)
+		go p.loop(pushed)
+	}
+	r.pusher = p
+	return p
+}
+
+// add count a hit in the current interval of every sink
+func (p *pusher) add(hit *Hit) {
+	if hit.retried {
+		return
+	}
+	cartridge := hit.shot.cartridge
+	key := metricKey{request: fmt.Sprintf("%v", cartridge.path.rawDescription), method: cartridge.getMethod()}
+	for _, pushed := range p.sinks {
+		pushed.mutex.Lock()
+		point, ok := pushed.points[key]
+		if !ok {
+			point = &sinkPoint{request: key.request, method: key.method, durations: NewHistogram()}
+			pushed.points[key] = point
+		}
+		point.requests++
+		if !hit.isSuccess() {
+			point.errors++
+		}
+		point.bytes += hit.bodySize
+		point.durations.record(hit.endTime.Sub(hit.startTime))
+		pushed.mutex.Unlock()
+	}
+}
+
+// loop push the results of a sink at every interval, and once more when the
+// pusher stops
+func (p *pusher) loop(pushed *pushedSink) {
+	defer p.group.Done()
+	defer pushed.sink.close()
+	ticker := time.NewTicker(pushed.sink.getInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.flush(pushed)
+		case <-p.done:
+			p.flush(pushed)
+			return
+		}
+	}
+}
+
+// flush push the results of the current interval of a sink and start a new
+// one
+func (p *pusher) flush(pushed *pushedSink) {
+	pushed.mutex.Lock()
+	points := make([]*sinkPoint, 0, len(pushed.points))
+	for _, point := range pushed.points {
+		points = append(points, point)
+	}
+	pushed.points = make(map[metricKey]*sinkPoint)
+	pushed.mutex.Unlock()
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].request != points[j].request {
+			return points[i].request < points[j].request
+		}
+		return points[i].method < points[j].method
+	})
+	activeVUs := int(atomic.LoadInt32(&p.run.activeVUs))
+	pushed.sink.push(points, activeVUs, p.run.attack.getVirtualUsers(), time.Now())
+}
+
+// stop push what is left and stop
+func (p *pusher) stop() {
+	close(p.done)
+	p.group.Wait()
+	p.run.pusher = nil
+}
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSinkPoints get the results of a request over an interval
+func newSinkPoints() []*sinkPoint {
+	durations := NewHistogram()
+	durations.record(10 * time.Millisecond)
+	durations.record(30 * time.Millisecond)
+	return []*sinkPoint{{request: "/items/${id}", method: GET_METHOD, requests: 2, errors: 1, bytes: 100, durations: durations}}
+}
+
+func TestSinkFormat(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	tags := map[string]string{"test": "smoke test", "environment": "staging"}
+	want := map[string][]string{
+		SINK_INFLUXDB: {
+			`mgun,environment=staging,test=smoke\ test,request=/items/${id},method=GET requests=2i,errors=1i,bytes=100i,mean=20,p50=10.048,p95=30,p99=30,max=30 1600000000000000000`,
+			`mgun,environment=staging,test=smoke\ test active_vus=3,vus=4 1600000000000000000`,
+		},
+		SINK_STATSD: {
+			"mgun.requests:2|c|#environment:staging,test:smoke test,request:/items/${id},method:GET",
+			"mgun.p95:30|g|#environment:staging,test:smoke test,request:/items/${id},method:GET",
+			"mgun.active_vus:3|g|#environment:staging,test:smoke test",
+		},
+		SINK_GRAPHITE: {
+			"mgun.requests;environment=staging;test=smoke_test;request=/items/${id};method=GET 2 1600000000",
+			"mgun.mean;environment=staging;test=smoke_test;request=/items/${id};method=GET 20 1600000000",
+			"mgun.vus;environment=staging;test=smoke_test 4 1600000000",
+		},
+	}
+	for kind, lines := range want {
+		sink := &Sink{Type: kind, Address: "localhost:1", Tags: tags}
+		if err := sink.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		formatted := strings.Join(sink.format(newSinkPoints(), 3, 4, at), "\n")
+		for _, line := range lines {
+			if !strings.Contains(formatted+"\n", line+"\n") {
+				t.Errorf("%s: expected the line %s in:\n%s", kind, line, formatted)
+			}
+		}
+	}
+
+	for _, sink := range []*Sink{{Type: "kafka"}, {Type: SINK_STATSD}, {Type: SINK_INFLUXDB}} {
+		if err := sink.prepare(); err == nil {
+			t.Errorf("expected the sink %+v to be refused", sink)
+		}
+	}
+}
+
+func TestSinkSend(t *testing.T) {
+	// InfluxDB over HTTP
+	bodies := make(chan string, 1)
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- r.Header.Get("Authorization") + "\n" + string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+	sink := &Sink{Type: SINK_INFLUXDB, URL: influx.URL + "/write?db=mgun", Token: "secret"}
+	sink.prepare()
+	if err := sink.send([]string{"mgun requests=1i"}); err != nil {
+		t.Fatal(err)
+	}
+	if body := <-bodies; body != "Token secret\nmgun requests=1i\n" {
+		t.Errorf("got %q sent to InfluxDB", body)
+	}
+
+	// StatsD and InfluxDB over UDP
+	for _, kind := range []string{SINK_STATSD, SINK_INFLUXDB} {
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink := &Sink{Type: kind, Address: listener.LocalAddr().String()}
+		sink.prepare()
+		sink.push(newSinkPoints(), 1, 1, time.Now())
+		sink.close()
+		buffer := make([]byte, SINK_PACKET_SIZE)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if !strings.Contains(string(buffer[:n]), "requests") {
+			t.Errorf("%s: got %q", kind, buffer[:n])
+		}
+		listener.Close()
+	}
+
+	// Graphite over TCP
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+	sink = &Sink{Type: SINK_GRAPHITE, Address: listener.Addr().String()}
+	sink.prepare()
+	if err := sink.send([]string{"mgun.requests 2 1600000000"}); err != nil {
+		t.Fatal(err)
+	}
+	sink.close()
+	if line := <-received; line != "mgun.requests 2 1600000000\n" {
+		t.Errorf("got %q sent to Graphite", line)
+	}
+}
+
+func TestSinkPush(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mock.Close()
+	run, err := NewRun([]byte(`
+base_url: `+mock.URL+`
+concurrency: 2
+loopcount: 3
+requests:
+  - GET: /items
+sinks:
+  - type: statsd
+    address: `+listener.LocalAddr().String()+`
+    prefix: loadtest
+    tags: {test: push}
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attack := run.Attack()
+	attack.setRateLimit()
+	pusher := run.startPush()
+	attack.launch(context.Background(), attack.AttemptsCount, false, func(hits <-chan *Hit) {
+		for hit := range hits {
+			pusher.add(hit)
+		}
+	})
+	pusher.stop()
+
+	buffer := make([]byte, SINK_PACKET_SIZE)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "loadtest.requests:6|c|#test:push,request:/items,method:GET\n"; !strings.Contains(string(buffer[:n]), want) {
+		t.Errorf("expected %q in %q", want, buffer[:n])
+	}
+}
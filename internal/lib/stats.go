@@ -0,0 +1,220 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cznic/mathutil"
+)
+
+// RATE_WINDOW seconds of requests per second kept apart, for hits that arrive
+// late, before they are folded into the minimum, average and maximum
+const RATE_WINDOW = 10
+
+// Stats the statistics of the hits of an attack, updated as they arrive so
+// that a report can be made at any point of a run
+type Stats struct {
+	mutex sync.Mutex
+	// the load, in whole seconds, phases left out
+	startTime       int64
+	endTime         int64
+	rates           map[int]*rateCounter
+	reports         map[int]*RequestReport
+	hostReports     map[string]*RequestReport
+	scenarioReports map[string]*RequestReport
+	// statuses of retried attempts by cartridge, 0 for no response
+	retries      map[int]map[int]int
+	retriesCount int
+	// the requests of the load since the last stats line
+	window       *Histogram
+	windowErrors int
+	windowStart  time.Time
+	started      time.Time
+}
+
+// NewStats create empty statistics
+func NewStats() *Stats {
+	return &Stats{
+		rates:           make(map[int]*rateCounter),
+		reports:         make(map[int]*RequestReport),
+		hostReports:     make(map[string]*RequestReport),
+		scenarioReports: make(map[string]*RequestReport),
+		retries:         make(map[int]map[int]int),
+		window:          NewHistogram(),
+		windowStart:     time.Now(),
+		started:         time.Now(),
+	}
+}
+
+// add count a hit in the statistics
+func (s *Stats) add(hit *Hit) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := hit.shot.cartridge.id
+	// Retried attempts are reported apart, the request being counted once
+	// with its last attempt
+	if hit.retried {
+		if _, ok := s.retries[key]; !ok {
+			s.retries[key] = make(map[int]int)
+		}
+		status := 0
+		if hit.response != nil {
+			status = hit.response.StatusCode
+		}
+		s.retries[key][status]++
+		s.retriesCount++
+		return
+	}
+	if report, ok := s.reports[key]; ok {
+		report.update(hit)
+	} else {
+		s.reports[key] = NewRequestReport(hit)
+	}
+
+	if _, ok := s.rates[key]; !ok {
+		s.rates[key] = newRateCounter()
+	}
+	s.rates[key].add(hit.endTime.Unix())
+
+	// Setup and teardown requests are reported on their own and do not count
+	// towards the load
+	if len(hit.shot.cartridge.phase) > 0 {
+		return
+	}
+
+	if s.startTime == 0 {
+		s.startTime = hit.startTime.Unix()
+	} else {
+		s.startTime = mathutil.MinInt64(s.startTime, hit.startTime.Unix())
+	}
+	s.endTime = mathutil.MaxInt64(s.endTime, hit.endTime.Unix())
+
+	host := hit.shot.request.URL.Host
+	if report, ok := s.hostReports[host]; ok {
+		report.update(hit)
+	} else {
+		s.hostReports[host] = NewRequestReport(hit)
+	}
+
+	if hit.shot.killer != nil && len(hit.shot.killer.scenario.name) > 0 {
+		name := hit.shot.killer.scenario.name
+		if report, ok := s.scenarioReports[name]; ok {
+			report.update(hit)
+		} else {
+			s.scenarioReports[name] = NewRequestReport(hit)
+		}
+	}
+
+	s.window.record(hit.endTime.Sub(hit.startTime))
+	if !hit.isSuccess() {
+		s.windowErrors++
+	}
+}
+
+// line get a line of the statistics of the load since the last one, and
+// start a new window
+func (s *Stats) line(activeVUs int, virtualUsers int) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(s.windowStart).Seconds()
+	rate, errorRate := 0.0, 0.0
+	if elapsed > 0 {
+		rate = float64(s.window.count()) / elapsed
+	}
+	if s.window.count() > 0 {
+		errorRate = float64(s.windowErrors) * 100 / float64(s.window.count())
+	}
+	line := fmt.Sprintf(
+		"%-8v rps %-8.2f p50 %-8v p95 %-8v errors %-7s vus %d/%d",
+		now.Sub(s.started).Round(time.Second),
+		rate,
+		s.window.percentile(50).Round(time.Millisecond),
+		s.window.percentile(95).Round(time.Millisecond),
+		fmt.Sprintf("%.2f%%", errorRate),
+		activeVUs,
+		virtualUsers,
+	)
+
+	s.window.reset()
+	s.windowErrors = 0
+	s.windowStart = now
+	return line
+}
+
+// printLines print a line of statistics at every interval until done is
+// closed
+func (a *Attack) printLines(stats *Stats, interval time.Duration, done <-chan struct{}) {
+	virtualUsers := a.getVirtualUsers()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Println(stats.line(int(atomic.LoadInt32(&a.run.activeVUs)), virtualUsers))
+		case <-done:
+			return
+		}
+	}
+}
+
+// rateCounter the requests per second of a request, counting the latest
+// seconds apart and folding older ones into a minimum, sum and maximum
+type rateCounter struct {
+	seconds map[int64]int64
+	latest  int64
+	// the seconds folded so far
+	count int64
+	sum   int64
+	min   int64
+	max   int64
+}
+
+// newRateCounter create an empty rate counter
+func newRateCounter() *rateCounter {
+	return &rateCounter{seconds: make(map[int64]int64)}
+}
+
+// add count a request that ended in a second
+func (c *rateCounter) add(second int64) {
+	c.seconds[second]++
+	if second <= c.latest {
+		return
+	}
+	c.latest = second
+	for other, count := range c.seconds {
+		if other <= second-RATE_WINDOW {
+			c.fold(count)
+			delete(c.seconds, other)
+		}
+	}
+}
+
+// fold count a second in the minimum, sum and maximum
+func (c *rateCounter) fold(count int64) {
+	if c.count == 0 || count < c.min {
+		c.min = count
+	}
+	if count > c.max {
+		c.max = count
+	}
+	c.count++
+	c.sum += count
+}
+
+// get get the lowest, average and highest requests per second, over the
+// seconds with requests
+func (c *rateCounter) get() (int64, float64, int64) {
+	total := *c
+	for _, count := range c.seconds {
+		total.fold(count)
+	}
+	if total.count == 0 {
+		return 0, 0, 0
+	}
+	return total.min, float64(total.sum) / float64(total.count), total.max
+}
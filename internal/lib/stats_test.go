@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	load := &Cartridge{id: 1, successStatusCodes: []int{200}}
+	setup := &Cartridge{id: 2, phase: PHASE_SETUP, successStatusCodes: []int{200}}
+	request, _ := http.NewRequest(GET_METHOD, "http://example.com/", nil)
+	newHit := func(cartridge *Cartridge, status int, took time.Duration) *Hit {
+		now := time.Now()
+		return &Hit{
+			shot:      &Shot{cartridge: cartridge, request: request},
+			response:  &http.Response{StatusCode: status},
+			startTime: now.Add(-took),
+			endTime:   now,
+		}
+	}
+
+	stats := NewStats()
+	for i := 1; i <= 10; i++ {
+		status := 200
+		if i == 10 {
+			status = 500
+		}
+		stats.add(newHit(load, status, time.Duration(i)*10*time.Millisecond))
+	}
+	stats.add(newHit(setup, 200, time.Second))
+	retried := newHit(load, 503, time.Millisecond)
+	retried.retried = true
+	stats.add(retried)
+
+	if report := stats.reports[1]; report.totalRequests != 10 || report.failedRequests != 1 {
+		t.Errorf("got %d requests and %d failures, want 10 and 1", report.totalRequests, report.failedRequests)
+	}
+	if stats.retriesCount != 1 || stats.retries[1][503] != 1 {
+		t.Errorf("expected the retried attempt to be counted apart, got %v", stats.retries)
+	}
+
+	line := stats.line(3, 4)
+	for _, part := range []string{"p50 50ms", "p95 100ms", "errors 10.00%", "vus 3/4"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("expected %q in the line %q", part, line)
+		}
+	}
+	// A line starts a new window
+	if line := stats.line(0, 4); !strings.Contains(line, "rps 0.00") || !strings.Contains(line, "errors 0.00%") {
+		t.Errorf("expected an empty window, got %q", line)
+	}
+}
@@ -0,0 +1,147 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	THINK_KIND_FIXED       = "fixed"
+	THINK_KIND_UNIFORM     = "uniform"
+	THINK_KIND_NORMAL      = "normal"
+	THINK_KIND_EXPONENTIAL = "exponential"
+)
+
+// Think a pause after a request or group, as a user reading a page would
+// take, in seconds
+//
+//	think: 2                   fixed
+//	think: {uniform: [1, 3]}   between 1 and 3
+//	think: {normal: [2, 0.5]}  mean and standard deviation
+//	think: {exponential: 2}    mean
+//
+// max caps the normal and exponential distributions, which are unbounded,
+// for example {exponential: 2, max: 10}.
+type Think struct {
+	kind string
+	a    float64
+	b    float64
+	max  float64
+}
+
+func (t *Think) UnmarshalYAML(unmarshal func(yaml interface{}) error) error {
+	var rawThink interface{}
+	if err := unmarshal(&rawThink); err != nil {
+		return err
+	}
+	think, err := NewThink(rawThink)
+	if err != nil {
+		return err
+	}
+	*t = *think
+	return nil
+}
+
+// NewThink create a think time from its raw value
+func NewThink(rawValue interface{}) (*Think, error) {
+	if seconds, ok := toFloat(rawValue); ok {
+		if seconds < 0 {
+			return nil, fmt.Errorf("think must not be negative")
+		}
+		return &Think{kind: THINK_KIND_FIXED, a: seconds}, nil
+	}
+	rawThink, ok := rawValue.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("think must be a number of seconds or a distribution")
+	}
+
+	think := new(Think)
+	for rawKey, rawValue := range rawThink {
+		key := fmt.Sprintf("%v", rawKey)
+		if key == "max" {
+			max, ok := toFloat(rawValue)
+			if !ok || max <= 0 {
+				return nil, fmt.Errorf("think max must be a positive number")
+			}
+			think.max = max
+			continue
+		}
+		if len(think.kind) > 0 {
+			return nil, fmt.Errorf("think takes a single distribution")
+		}
+		think.kind = key
+
+		values := make([]float64, 0, 2)
+		rawValues, ok := rawValue.([]interface{})
+		if !ok {
+			rawValues = []interface{}{rawValue}
+		}
+		for _, rawValue := range rawValues {
+			value, ok := toFloat(rawValue)
+			if !ok || value < 0 {
+				return nil, fmt.Errorf("think %s values must be positive numbers", key)
+			}
+			values = append(values, value)
+		}
+
+		switch key {
+		case THINK_KIND_FIXED, THINK_KIND_EXPONENTIAL:
+			if len(values) != 1 {
+				return nil, fmt.Errorf("think %s takes a number of seconds", key)
+			}
+			think.a = values[0]
+		case THINK_KIND_UNIFORM, THINK_KIND_NORMAL:
+			if len(values) != 2 {
+				return nil, fmt.Errorf("think %s takes a list of two numbers", key)
+			}
+			think.a, think.b = values[0], values[1]
+			if key == THINK_KIND_UNIFORM && think.a > think.b {
+				return nil, fmt.Errorf("think uniform minimum is above its maximum")
+			}
+		default:
+			return nil, fmt.Errorf("unknown think distribution %s", key)
+		}
+	}
+	if len(think.kind) == 0 {
+		return nil, fmt.Errorf("think needs a distribution")
+	}
+	return think, nil
+}
+
+// duration draw a think time
+func (t *Think) duration(r *rand.Rand) time.Duration {
+	var seconds float64
+	switch t.kind {
+	case THINK_KIND_FIXED:
+		seconds = t.a
+	case THINK_KIND_UNIFORM:
+		seconds = t.a + r.Float64()*(t.b-t.a)
+	case THINK_KIND_NORMAL:
+		seconds = math.Max(0, r.NormFloat64()*t.b+t.a)
+	case THINK_KIND_EXPONENTIAL:
+		seconds = r.ExpFloat64() * t.a
+	}
+	if t.max > 0 {
+		seconds = math.Min(seconds, t.max)
+	}
+	return toDuration(seconds)
+}
+
+// think pause a killer as a user would
+func (k *Killer) think(think *Think) {
+	duration := think.duration(k.rand)
+	k.run.log("think - %v", duration)
+	k.sleep(duration)
+}
+
+// pace wait for the rest of the pacing of a scenario, so that an iteration
+// started at the given time takes at least that long
+func (k *Killer) pace(started time.Time) {
+	pacing := toDuration(k.callCollection.Pacing)
+	if wait := pacing - time.Since(started); wait > 0 {
+		k.run.log("pacing - %v", wait)
+		k.sleep(wait)
+	}
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestThink(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	checks := map[string][2]time.Duration{
+		`1.5`:                         {1500 * time.Millisecond, 1500 * time.Millisecond},
+		`{fixed: 2}`:                  {2 * time.Second, 2 * time.Second},
+		`{uniform: [1, 3]}`:           {time.Second, 3 * time.Second},
+		`{normal: [2, 0.5]}`:          {0, 5 * time.Second},
+		`{exponential: 2, max: 0.25}`: {0, 250 * time.Millisecond},
+	}
+	for rawThink, bounds := range checks {
+		var raw interface{}
+		if err := yaml.Unmarshal([]byte(rawThink), &raw); err != nil {
+			t.Fatal(err)
+		}
+		think, err := NewThink(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", rawThink, err)
+		}
+		for i := 0; i < 100; i++ {
+			if d := think.duration(r); d < bounds[0] || d > bounds[1] {
+				t.Fatalf("%s: got %v, want between %v and %v", rawThink, d, bounds[0], bounds[1])
+			}
+		}
+	}
+
+	for _, rawThink := range []string{`-1`, `{uniform: 2}`, `{uniform: [3, 1]}`, `{poisson: 1}`, `{fixed: 1, uniform: [1, 2]}`} {
+		var raw interface{}
+		yaml.Unmarshal([]byte(rawThink), &raw)
+		if _, err := NewThink(raw); err == nil {
+			t.Errorf("%s: expected an error", rawThink)
+		}
+	}
+}
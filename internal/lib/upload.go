@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// UploadFile a file sent as part of a multipart request, given in the files
+// list of a request
+//
+//	files:
+//	  - field: image
+//	    path: media/photo.jpg
+//	    filename: upload.jpg
+//	    content_type: image/jpeg
+//
+// When path is a directory a random file from it is sent with each request.
+type UploadFile struct {
+	field       string
+	path        string
+	filename    string
+	contentType string
+	entries     []string
+}
+
+// NewUploadFiles create upload files from the raw files list of a request
+func NewUploadFiles(rawFiles []interface{}) ([]*UploadFile, error) {
+	files := make([]*UploadFile, 0, len(rawFiles))
+	for _, rawFile := range rawFiles {
+		rawMap, ok := rawFile.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid files entry %v", rawFile)
+		}
+		file := new(UploadFile)
+		file.field, _ = rawMap["field"].(string)
+		file.path, _ = rawMap["path"].(string)
+		file.filename, _ = rawMap["filename"].(string)
+		file.contentType, _ = rawMap["content_type"].(string)
+		if len(file.field) == 0 || len(file.path) == 0 {
+			return nil, fmt.Errorf("files entry needs a field and a path")
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// prepare check the file to upload, listing the files of a directory
+func (u *UploadFile) prepare() error {
+	info, err := os.Stat(u.path)
+	if err != nil {
+		return fmt.Errorf("could not find upload file: %v", err)
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	infos, err := ioutil.ReadDir(u.path)
+	if err != nil {
+		return fmt.Errorf("could not read upload directory: %v", err)
+	}
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			u.entries = append(u.entries, filepath.Join(u.path, info.Name()))
+		}
+	}
+	if len(u.entries) == 0 {
+		return fmt.Errorf("upload directory %s has no files", u.path)
+	}
+	return nil
+}
+
+// pick get the path of the file to send, drawn from the killer's source
+func (u *UploadFile) pick(r *rand.Rand) string {
+	if len(u.entries) > 0 {
+		return u.entries[r.Intn(len(u.entries))]
+	}
+	return u.path
+}
+
+// uploadPart a file chosen for one request
+type uploadPart struct {
+	header textproto.MIMEHeader
+	path   string
+	size   int64
+}
+
+func newUploadPart(file *UploadFile, r *rand.Rand) (*uploadPart, error) {
+	path := file.pick(r)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	filename := file.filename
+	if len(filename) == 0 {
+		filename = filepath.Base(path)
+	}
+	contentType := file.contentType
+	if len(contentType) == 0 {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(
+		`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(file.field),
+		quoteEscaper.Replace(filename),
+	))
+	header.Set("Content-Type", contentType)
+	return &uploadPart{header: header, path: path, size: info.Size()}, nil
+}
+
+// multipartUpload a multipart body that streams its files from disk as it is
+// read, so large files are never buffered in memory
+type multipartUpload struct {
+	fields   [][2]string
+	parts    []*uploadPart
+	boundary string
+	once     sync.Once
+	reader   *io.PipeReader
+	writer   *io.PipeWriter
+}
+
+func newMultipartUpload(fields [][2]string, parts []*uploadPart) *multipartUpload {
+	reader, writer := io.Pipe()
+	return &multipartUpload{
+		fields:   fields,
+		parts:    parts,
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+		reader:   reader,
+		writer:   writer,
+	}
+}
+
+func (m *multipartUpload) contentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// length get the exact size of the body without reading any file
+func (m *multipartUpload) length() int64 {
+	counter := new(countingWriter)
+	m.write(counter, false)
+	for _, part := range m.parts {
+		counter.n += part.size
+	}
+	return counter.n
+}
+
+// write the multipart body, with file contents only if withFiles is set
+func (m *multipartUpload) write(w io.Writer, withFiles bool) error {
+	writer := multipart.NewWriter(w)
+	writer.SetBoundary(m.boundary)
+	for _, field := range m.fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	for _, part := range m.parts {
+		partWriter, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		if withFiles {
+			if err := m.copyFile(partWriter, part.path); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+func (m *multipartUpload) copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Read start streaming on the first read, not when the request is built
+func (m *multipartUpload) Read(p []byte) (int, error) {
+	m.once.Do(func() {
+		go func() {
+			m.writer.CloseWithError(m.write(m.writer, true))
+		}()
+	})
+	return m.reader.Read(p)
+}
+
+func (m *multipartUpload) Close() error {
+	return m.reader.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"notes.json":   `{"notes": true}`,
+		"images/a.png": "first image",
+		"images/b.png": "second image, a little longer",
+		"clip.bin":     string(bytes.Repeat([]byte{0, 1, 2, 255}, 50000)),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploads, err := NewUploadFiles([]interface{}{
+		map[interface{}]interface{}{"field": "notes", "path": filepath.Join(dir, "notes.json")},
+		map[interface{}]interface{}{"field": "image", "path": filepath.Join(dir, "images")},
+		map[interface{}]interface{}{"field": "clip", "path": filepath.Join(dir, "clip.bin"), "filename": "upload.mp4", "content_type": "video/mp4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make([]*uploadPart, 0, len(uploads))
+	for _, upload := range uploads {
+		if err := upload.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		part, err := newUploadPart(upload, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part)
+	}
+
+	upload := newMultipartUpload([][2]string{{"title", "hello"}, {"tag", `a "quoted" tag`}}, parts)
+	length := upload.length()
+	body, err := ioutil.ReadAll(upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != length {
+		t.Fatalf("streamed %d bytes, want the Content-Length of %d", len(body), length)
+	}
+
+	_, params, err := mime.ParseMediaType(upload.contentType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+	if form.Value["title"][0] != "hello" || form.Value["tag"][0] != `a "quoted" tag` {
+		t.Errorf("got fields %v", form.Value)
+	}
+
+	tests := []struct {
+		field       string
+		filename    string
+		contentType string
+	}{
+		{"notes", "notes.json", "application/json"},
+		{"image", "", "image/png"},
+		{"clip", "upload.mp4", "video/mp4"},
+	}
+	for _, test := range tests {
+		headers := form.File[test.field]
+		if len(headers) != 1 {
+			t.Errorf("got %d files for %s, want 1", len(headers), test.field)
+			continue
+		}
+		header := headers[0]
+		if len(test.filename) > 0 && header.Filename != test.filename {
+			t.Errorf("%s: got filename %s, want %s", test.field, header.Filename, test.filename)
+		}
+		if got := header.Header.Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: got content type %s, want %s", test.field, got, test.contentType)
+		}
+		file, err := header.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(file)
+		file.Close()
+		name := header.Filename
+		if test.field == "clip" {
+			name = "clip.bin"
+		} else if test.field == "image" {
+			name = "images/" + name
+		}
+		if string(content) != files[name] {
+			t.Errorf("%s: got %d bytes, want the %d of %s", test.field, len(content), len(files[name]), name)
+		}
+	}
+}
+
+func TestUploadFilePick(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "nested"), 0755)
+
+	upload := &UploadFile{field: "image", path: dir}
+	if err := upload.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if len(upload.entries) != 3 {
+		t.Fatalf("got %d entries, want the 3 files and not the directory", len(upload.entries))
+	}
+	r := rand.New(rand.NewSource(1))
+	picked := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		picked[filepath.Base(upload.pick(r))]++
+	}
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		if picked[name] == 0 {
+			t.Errorf("%s was never picked: %v", name, picked)
+		}
+	}
+
+	empty := &UploadFile{field: "image", path: filepath.Join(dir, "nested")}
+	if err := empty.prepare(); err == nil {
+		t.Error("expected an error for a directory without files")
+	}
+}
@@ -0,0 +1,219 @@
+// Package loadtest runs mgun load tests from Go code, so that tests can assert
+// on how a service behaves under load.
+//
+//	result, err := loadtest.Run(ctx, loadtest.Config{
+//		BaseURL:     server.URL,
+//		Concurrency: 4,
+//		Iterations:  10,
+//		Requests: []loadtest.Request{
+//			{Method: "GET", Path: "/items"},
+//		},
+//	})
+//	if stats := result.Request("GET /items"); stats.P95 > 100*time.Millisecond {
+//		t.Errorf("p95 of %v", stats.P95)
+//	}
+//
+// Everything an mgun configuration can do, such as scenarios, auth or
+// extraction, is available by giving it as YAML or as a file. Runs share
+// nothing, so several can be made at once, such as from parallel tests.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/imarsman/mgun/internal/lib"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config a load test
+type Config struct {
+	// File or YAML give an mgun configuration, File with the files it extends
+	// and Environment applied. The fields below override its settings.
+	File        string
+	Environment string
+	YAML        []byte
+
+	BaseURL     string
+	Concurrency int
+	// how many times each virtual user runs the requests
+	Iterations int
+	// how long virtual users run the requests for, instead of iterations
+	Duration time.Duration
+	// requests per second, no limit when 0
+	Rate     int
+	Timeout  time.Duration
+	Headers  map[string]string
+	Params   map[string]string
+	Requests []Request
+}
+
+// Request a request of a load test, whose path and values may use params as
+// ${name}
+type Request struct {
+	Method  string
+	Path    string
+	Headers map[string]string
+	Params  map[string]string
+	Body    string
+}
+
+// Result the statistics of a load test
+type Result struct {
+	Duration time.Duration
+	Requests []RequestStats
+	// attempts that were sent again, not counted in the requests
+	Retries int
+}
+
+// RequestStats the statistics of a request, named by its method and path as
+// in the configuration, such as "GET /items/${id}"
+type RequestStats struct {
+	Name     string
+	Scenario string
+	// setup, vu setup or teardown, empty for requests of the load
+	Phase    string
+	Requests int
+	Failures int
+	Statuses map[int]int
+	Min      time.Duration
+	Mean     time.Duration
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	Bytes    int64
+}
+
+// Run run a load test. It stops between two requests when the context is
+// done, returning what was measured until then along with the context error.
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	data, err := cfg.compose()
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := lib.NewRun(data, cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	libResult := run.Attack().Run(ctx, cfg.Duration)
+
+	result := &Result{
+		Duration: libResult.Duration,
+		Retries:  libResult.Retries,
+		Requests: make([]RequestStats, 0, len(libResult.Requests)),
+	}
+	for _, request := range libResult.Requests {
+		result.Requests = append(result.Requests, RequestStats{
+			Name:     request.Name,
+			Scenario: request.Scenario,
+			Phase:    request.Phase,
+			Requests: request.Requests,
+			Failures: request.Failures,
+			Statuses: request.Statuses,
+			Min:      request.Min,
+			Mean:     request.Mean,
+			P50:      request.P50,
+			P95:      request.P95,
+			P99:      request.P99,
+			Max:      request.Max,
+			Bytes:    request.Bytes,
+		})
+	}
+	return result, ctx.Err()
+}
+
+// Request get the statistics of a request by name, or nil if it was not sent.
+// The first one is returned when scenarios share a request.
+func (r *Result) Request(name string) *RequestStats {
+	for i := range r.Requests {
+		if r.Requests[i].Name == name {
+			return &r.Requests[i]
+		}
+	}
+	return nil
+}
+
+// Total get the number of requests and of failures of the load, phases left
+// out
+func (r *Result) Total() (requests int, failures int) {
+	for _, request := range r.Requests {
+		if len(request.Phase) == 0 {
+			requests += request.Requests
+			failures += request.Failures
+		}
+	}
+	return requests, failures
+}
+
+// compose get the mgun configuration of a load test
+func (cfg Config) compose() ([]byte, error) {
+	data := cfg.YAML
+	if len(cfg.File) > 0 {
+		var err error
+		data, err = lib.LoadConfig(cfg.File, cfg.Environment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.BaseURL) > 0 {
+		config["base_url"] = cfg.BaseURL
+	}
+	if cfg.Concurrency > 0 {
+		config["concurrency"] = cfg.Concurrency
+	}
+	if cfg.Iterations > 0 {
+		config["loopcount"] = cfg.Iterations
+	}
+	if cfg.Rate > 0 {
+		config["ratepersecond"] = cfg.Rate
+	}
+	if cfg.Timeout > 0 {
+		// mgun takes whole seconds
+		config["timeout"] = int(math.Ceil(cfg.Timeout.Seconds()))
+	}
+	mergeValues(config, "headers", cfg.Headers)
+	mergeValues(config, "params", cfg.Params)
+
+	if len(cfg.Requests) > 0 {
+		requests := make([]interface{}, 0, len(cfg.Requests))
+		for i, request := range cfg.Requests {
+			if len(request.Method) == 0 || len(request.Path) == 0 {
+				return nil, fmt.Errorf("request %d needs a method and a path", i+1)
+			}
+			rawRequest := map[interface{}]interface{}{request.Method: request.Path}
+			mergeValues(rawRequest, "headers", request.Headers)
+			mergeValues(rawRequest, "params", request.Params)
+			if len(request.Body) > 0 {
+				// Given as text so that a leading @ is not read as a file
+				rawRequest["body"] = map[interface{}]interface{}{"text": request.Body}
+			}
+			requests = append(requests, rawRequest)
+		}
+		config["requests"] = requests
+	}
+	return yaml.Marshal(config)
+}
+
+// mergeValues add values to a map of a configuration
+func mergeValues(config map[interface{}]interface{}, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	merged, ok := config[key].(map[interface{}]interface{})
+	if !ok {
+		merged = make(map[interface{}]interface{})
+	}
+	for name, value := range values {
+		merged[name] = value
+	}
+	config[key] = merged
+}
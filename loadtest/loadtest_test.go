@@ -0,0 +1,127 @@
+package loadtest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imarsman/mgun/internal/lib"
+)
+
+func newMockServer(t *testing.T) *httptest.Server {
+	server, err := lib.NewServer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server)
+}
+
+func TestRun(t *testing.T) {
+	mock := newMockServer(t)
+	defer mock.Close()
+
+	result, err := Run(context.Background(), Config{
+		BaseURL:     mock.URL,
+		Concurrency: 2,
+		Iterations:  3,
+		Headers:     map[string]string{"X-Test": "run"},
+		Requests: []Request{
+			{Method: "POST", Path: "/login", Body: "@user"},
+			{Method: "GET", Path: "/items/${id}", Params: map[string]string{"id": "7"}},
+			{Method: "GET", Path: "/missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"POST /login", "GET /items/${id}", "GET /missing"} {
+		stats := result.Request(name)
+		if stats == nil || stats.Requests != 6 {
+			t.Fatalf("%s: got %+v, want 6 requests", name, stats)
+		}
+		if stats.Min > stats.P95 || stats.P95 > stats.Max || stats.Mean == 0 {
+			t.Errorf("%s: inconsistent times %+v", name, stats)
+		}
+	}
+	if missing := result.Request("GET /missing"); missing.Failures != 6 || missing.Statuses[404] != 6 {
+		t.Errorf("expected every request to /missing to fail with 404, got %+v", missing)
+	}
+	if requests, failures := result.Total(); requests != 18 || failures != 6 {
+		t.Errorf("got %d requests and %d failures, want 18 and 6", requests, failures)
+	}
+}
+
+func TestRunYAML(t *testing.T) {
+	mock := newMockServer(t)
+	defer mock.Close()
+
+	result, err := Run(context.Background(), Config{
+		BaseURL:     mock.URL,
+		Concurrency: 2,
+		Duration:    300 * time.Millisecond,
+		YAML: []byte(`
+setup:
+  - GET: /items
+    extract:
+      ids: {json: items.*.id}
+requests:
+  - FOREACH: ids
+    do:
+      - GET: /echo?id=${item}
+`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup := result.Request("GET /items"); setup == nil || setup.Phase != "Setup" || setup.Requests != 1 {
+		t.Errorf("expected one setup request, got %+v", setup)
+	}
+	if requests, failures := result.Total(); requests < 3 || failures != 0 {
+		t.Errorf("got %d requests and %d failures, want some and none failed", requests, failures)
+	}
+	if result.Duration < 300*time.Millisecond || result.Duration > 2*time.Second {
+		t.Errorf("got a run of %v, want about 300ms", result.Duration)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, Config{BaseURL: mock.URL}); err != context.Canceled {
+		t.Errorf("got error %v, want the context error", err)
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	mock := newMockServer(t)
+	defer mock.Close()
+
+	paths := []string{"/items", "/echo", "/slow"}
+	errs := make(chan error, len(paths))
+	results := make([]*Result, len(paths))
+	for i, path := range paths {
+		go func(i int, path string) {
+			var err error
+			results[i], err = Run(context.Background(), Config{
+				BaseURL:     mock.URL,
+				Concurrency: 2,
+				Iterations:  2,
+				Requests:    []Request{{Method: "GET", Path: path}},
+			})
+			errs <- err
+		}(i, path)
+	}
+	for range paths {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, path := range paths {
+		if len(results[i].Requests) != 1 {
+			t.Fatalf("%s: got %+v, want only its own request", path, results[i].Requests)
+		}
+		if stats := results[i].Request("GET " + path); stats == nil || stats.Requests != 4 {
+			t.Errorf("%s: got %+v, want 4 requests", path, stats)
+		}
+	}
+}